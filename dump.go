@@ -4,26 +4,38 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
-	"time"
 	"zeta/internal/cache"
 	"zeta/internal/config"
+	"zeta/internal/ignore"
 	"zeta/internal/parser"
 	"zeta/internal/resolver"
 	"zeta/internal/scanner"
+	"zeta/internal/search"
 )
 
 func runDump(configPath string) error {
-	f, err := os.Open(configPath)
+	_, c, _, err := scanNotes(configPath)
 	if err != nil {
 		return err
 	}
+	fmt.Print(string(c.Dump()))
+	return nil
+}
+
+// scanNotes indexes the notes under the root of a config file, both their
+// links and their content.
+func scanNotes(configPath string) (*resolver.Resolver, cache.Cache, *search.Index, error) {
+	f, err := os.Open(configPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	defer f.Close()
 	cfg, err := config.LoadFromJSON(f)
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 
-	resolver.Configure(
+	r, err := resolver.New(
 		cfg.Root,
 		cfg.SelectRegex,
 		cfg.FileExtensions,
@@ -31,23 +43,39 @@ func runDump(configPath string) error {
 		cfg.TitleTemplate,
 		cfg.TitleSubstitutions,
 	)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	m, err := ignore.Load(cfg.Root, cfg.UseGitignore, cfg.Ignore)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r = r.WithIgnore(m)
 
 	c := cache.NewCache()
-	now := time.Now()
-	skip := func(path string, info fs.FileInfo) bool {
-		return false // always re-scan for dump
+	index := search.NewIndex()
+	skip := func(note resolver.Note, info fs.FileInfo) bool {
+		return false // always re-scan
 	}
-	parserPool := parser.NewParserPool(10)
-	callback := func(path string, data []byte) {
-		note, err := resolver.Resolve(path)
+	parserPool := parser.NewParserPool(max(10, cfg.ScanWorkers))
+	type parsed struct {
+		links   []cache.Link
+		meta    cache.Metadata
+		state   cache.FileState
+		content search.Document
+	}
+	parse := func(note resolver.Note, info fs.FileInfo, data []byte) (parsed, error) {
+		matches, err := parserPool.ParseAndQuery(data, []byte(cfg.Query))
 		if err != nil {
-			return
+			return parsed{}, err
 		}
-		matches, _ := parserPool.ParseAndQuery(data, []byte(cfg.Query))
-		links, meta := resolver.ExtractLinksAndMeta(note, matches, data)
-		_ = c.SaveNote(note.CachePath, links, meta, now)
+		links, meta := r.ExtractLinksAndMeta(note, matches, data)
+		return parsed{links, meta, cache.NewFileState(data, info.ModTime()), search.Analyze(data)}, nil
 	}
-	scanner.Scan(cfg.Root, skip, callback)
-	fmt.Print(string(c.Dump()))
-	return nil
+	commit := func(note resolver.Note, p parsed) {
+		_ = c.SaveNote(note.CachePath, p.links, p.meta, p.state)
+		index.Put(note.CachePath, p.content)
+	}
+	scanner.Scan(r, cfg.ScanWorkers, skip, parse, commit)
+	return r, c, index, nil
 }
@@ -0,0 +1,269 @@
+package cache
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+)
+
+// DefaultBufferSize is the number of events buffered per subscriber unless
+// SubscribeOptions say otherwise.
+const DefaultBufferSize = 1024
+
+// LogSize is the number of recent events kept to resume subscriptions from.
+const LogSize = 4096
+
+// OverflowPolicy decides what happens when a subscriber falls so far behind
+// that its buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowResync discards the buffered events and delivers a Resync
+	// event followed by a snapshot of the whole graph instead.
+	OverflowResync OverflowPolicy = iota
+	// OverflowDrop delivers a Dropped event and closes the channel.
+	OverflowDrop
+)
+
+// SubscribeOptions configure a subscription. The zero value buffers
+// DefaultBufferSize events, resyncs on overflow and starts with a snapshot.
+type SubscribeOptions struct {
+	BufferSize int
+	Overflow   OverflowPolicy
+
+	// Since resumes a subscription after the event with this sequence
+	// number and Epoch. If that event is no longer logged, or was numbered
+	// by another graph, the subscription starts with a Resync event and a
+	// snapshot instead.
+	Since uint64
+	Epoch uint64
+}
+
+// bus fans events out to subscribers without ever blocking the publisher.
+// Every subscriber has a ring buffer that a goroutine of its own drains
+// into its channel. The last LogSize events are kept in a ring as well, to
+// replay them to resumed subscriptions.
+type bus struct {
+	mu          sync.Mutex
+	subscribers map[int]*subscriber
+	nextID      int
+
+	epoch   uint64 // random, so that resumed subscriptions find other graphs
+	seq     uint64 // sequence number of the last event
+	log     []Event
+	logHead int // index of the oldest logged event
+	logLen  int
+
+	// view is held for reading while taking a snapshot, so that no event
+	// is published in between. snapshot lists the events that build the
+	// current graph from scratch.
+	view     sync.Locker
+	snapshot func() []Event
+}
+
+type subscriber struct {
+	mu      sync.Mutex
+	ring    []Event
+	head    int // index of the oldest buffered event
+	count   int
+	policy  OverflowPolicy
+	resync  bool // deliver a snapshot next
+	initial bool // the next snapshot is the first, without a Resync event
+	missed  int  // events discarded since the last Resync
+	dropped bool
+	wake    chan struct{}
+}
+
+func newBus(view sync.Locker, snapshot func() []Event) *bus {
+	return &bus{
+		subscribers: map[int]*subscriber{},
+		epoch:       rand.Uint64(),
+		log:         make([]Event, LogSize),
+		view:        view,
+		snapshot:    snapshot,
+	}
+}
+
+// subscribe returns a channel that receives a snapshot of the graph, or the
+// events since opts.Since, and then every published event, until ctx is
+// cancelled.
+func (b *bus) subscribe(ctx context.Context, opts SubscribeOptions) <-chan Event {
+	size := opts.BufferSize
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	sub := &subscriber{
+		ring:    make([]Event, size),
+		policy:  opts.Overflow,
+		resync:  true,
+		initial: true,
+		wake:    make(chan struct{}, 1),
+	}
+
+	b.mu.Lock()
+	if opts.Since > 0 {
+		b.resume(sub, opts.Since, opts.Epoch)
+	}
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = sub
+	b.mu.Unlock()
+
+	ch := make(chan Event)
+	go func() {
+		defer func() {
+			b.mu.Lock()
+			delete(b.subscribers, id)
+			b.mu.Unlock()
+			close(ch)
+		}()
+		b.deliver(ctx, sub, ch)
+	}()
+	return ch
+}
+
+// resume buffers the logged events after since for a new subscriber. If
+// they are gone, or since is unknown, the subscriber resyncs. The caller
+// holds b.mu.
+func (b *bus) resume(sub *subscriber, since, epoch uint64) {
+	sub.initial = false
+	if epoch != b.epoch {
+		return // how many events were missed is unknown
+	}
+	if since > b.seq || b.seq-since > uint64(b.logLen) {
+		if since < b.seq {
+			sub.missed = int(b.seq - since)
+		}
+		return
+	}
+	sub.resync = false
+	for i := b.logLen - int(b.seq-since); i < b.logLen; i++ {
+		sub.push(b.log[(b.logHead+i)%len(b.log)])
+	}
+}
+
+// publish numbers an event, logs it and buffers it for every subscriber.
+func (b *bus) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	event.Seq, event.Epoch = b.seq, b.epoch
+	if b.logLen == len(b.log) {
+		b.log[b.logHead] = event
+		b.logHead = (b.logHead + 1) % len(b.log)
+	} else {
+		b.log[(b.logHead+b.logLen)%len(b.log)] = event
+		b.logLen++
+	}
+	for _, sub := range b.subscribers {
+		sub.push(event)
+	}
+}
+
+// push buffers an event, applying the overflow policy if the buffer is full.
+func (sub *subscriber) push(event Event) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	switch {
+	case sub.dropped:
+		return
+	case sub.resync:
+		sub.missed++ // superseded by the coming snapshot
+		return
+	case sub.count == len(sub.ring):
+		sub.missed += sub.count + 1
+		sub.head, sub.count = 0, 0
+		if sub.policy == OverflowDrop {
+			sub.dropped = true
+		} else {
+			sub.resync = true
+		}
+	default:
+		sub.ring[(sub.head+sub.count)%len(sub.ring)] = event
+		sub.count++
+	}
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver drains the buffer of a subscriber into its channel.
+func (b *bus) deliver(ctx context.Context, sub *subscriber, ch chan<- Event) {
+	send := func(ev Event) bool {
+		select {
+		case ch <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		sub.mu.Lock()
+		switch {
+		case sub.dropped:
+			missed := sub.missed
+			sub.mu.Unlock()
+			send(Event{Type: Dropped, Missed: missed})
+			return
+
+		case sub.resync:
+			sub.mu.Unlock()
+			events, header := b.resync(sub)
+			if header != nil && !send(*header) {
+				return
+			}
+			for _, ev := range events {
+				if !send(ev) {
+					return
+				}
+			}
+
+		case sub.count > 0:
+			ev := sub.ring[sub.head]
+			sub.ring[sub.head] = Event{}
+			sub.head = (sub.head + 1) % len(sub.ring)
+			sub.count--
+			sub.mu.Unlock()
+			if !send(ev) {
+				return
+			}
+
+		default:
+			sub.mu.Unlock()
+			select {
+			case <-sub.wake:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// resync takes a snapshot for a subscriber. Events published from then on
+// are buffered as usual. Unless this is the first snapshot, it is announced
+// by a Resync event with the number of events missed. The snapshot events
+// carry the sequence number of the last event they include.
+func (b *bus) resync(sub *subscriber) ([]Event, *Event) {
+	b.view.Lock()
+	defer b.view.Unlock()
+
+	b.mu.Lock()
+	seq := b.seq
+	b.mu.Unlock()
+
+	sub.mu.Lock()
+	var header *Event
+	if !sub.initial {
+		header = &Event{Type: Resync, Missed: sub.missed, Seq: seq, Epoch: b.epoch}
+	}
+	sub.resync, sub.initial, sub.missed = false, false, 0
+	sub.mu.Unlock()
+
+	events := b.snapshot()
+	for i := range events {
+		events[i].Seq, events[i].Epoch = seq, b.epoch
+	}
+	return events, header
+}
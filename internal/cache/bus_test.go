@@ -0,0 +1,126 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"zeta/internal/cache"
+)
+
+// next receives an event or fails after a second.
+func next(t *testing.T, events <-chan cache.Event) (cache.Event, bool) {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		return ev, ok
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+		return cache.Event{}, false
+	}
+}
+
+func TestSlowSubscriberResyncs(t *testing.T) {
+	g := cache.NewGraph()
+	g.UpsertNote("a.typ", nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, _ := g.Subscribe(ctx, cache.SubscribeOptions{BufferSize: 4})
+	if ev, _ := next(t, events); ev.Type != cache.CreateNote || ev.Note.Path != "a.typ" {
+		t.Fatalf("unexpected snapshot event %+v", ev)
+	}
+
+	// Nobody reads, yet writes go through.
+	for i := range 10 {
+		meta := cache.Metadata{"n": fmt.Sprint(i)}
+		if err := g.UpsertNote("a.typ", nil, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The subscriber may have taken one event off the buffer already.
+	ev, _ := next(t, events)
+	if ev.Type == cache.UpdateNote {
+		ev, _ = next(t, events)
+	}
+	if ev.Type != cache.Resync || ev.Missed < 6 {
+		t.Fatalf("expected a resync after missing events, got %+v", ev)
+	}
+	ev, _ = next(t, events)
+	if ev.Type != cache.CreateNote || ev.Note.Metadata["n"] != "9" {
+		t.Fatalf("snapshot is not current: %+v", ev)
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	g := cache.NewGraph()
+	g.UpsertNote("a.typ", nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, _ := g.Subscribe(ctx, cache.SubscribeOptions{BufferSize: 2, Overflow: cache.OverflowDrop})
+	next(t, events) // the snapshot
+	for i := range 10 {
+		g.UpsertNote(fmt.Sprintf("%d.typ", i), nil, nil)
+	}
+
+	var dropped cache.Event
+	for {
+		ev, ok := next(t, events)
+		if !ok {
+			break
+		}
+		dropped = ev
+	}
+	if dropped.Type != cache.Dropped || dropped.Missed == 0 {
+		t.Fatalf("expected a dropped event before the channel closed, got %+v", dropped)
+	}
+}
+
+func TestResumeSubscription(t *testing.T) {
+	g := cache.NewGraph()
+	g.UpsertNote("a.typ", []cache.Link{link("a.typ", "b.typ")}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, _ := g.Subscribe(ctx, cache.SubscribeOptions{})
+	var last, epoch uint64
+	for range 3 {
+		ev, _ := next(t, events)
+		last, epoch = ev.Seq, ev.Epoch
+	}
+	cancel()
+
+	g.UpsertNote("c.typ", nil, nil)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	events, _ = g.Subscribe(ctx, cache.SubscribeOptions{Since: last, Epoch: epoch})
+	ev, _ := next(t, events)
+	if ev.Type != cache.CreateNote || ev.Note.Path != "c.typ" || ev.Seq != last+1 {
+		t.Fatalf("expected only the missed event, got %+v", ev)
+	}
+
+	// Sequence numbers of another graph fall back to a snapshot.
+	other := cache.NewGraph()
+	other.UpsertNote("a.typ", nil, nil)
+	resumed, _ := other.Subscribe(ctx, cache.SubscribeOptions{Since: 1, Epoch: epoch})
+	if ev, _ := next(t, resumed); ev.Type != cache.Resync || ev.Epoch == epoch {
+		t.Fatalf("expected a resync, got %+v", ev)
+	}
+
+	// Sequence numbers that are no longer logged fall back to a snapshot.
+	for i := range cache.LogSize {
+		g.UpsertNote("c.typ", nil, cache.Metadata{"n": fmt.Sprint(i)})
+	}
+	resumed, _ = g.Subscribe(ctx, cache.SubscribeOptions{Since: last, Epoch: epoch})
+	ev, _ = next(t, resumed)
+	if ev.Type != cache.Resync || ev.Missed != cache.LogSize+1 {
+		t.Fatalf("expected a resync, got %+v", ev)
+	}
+	for range 4 {
+		if ev, _ := next(t, resumed); ev.Type != cache.CreateNote && ev.Type != cache.CreateLink {
+			t.Fatalf("unexpected snapshot event %+v", ev)
+		}
+	}
+}
@@ -2,48 +2,91 @@ package cache
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io/fs"
 	"sync"
 	"time"
 )
 
+// FileState identifies the content of a note's file when it was saved.
+type FileState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"` // hex encoded SHA-256 of the content
+}
+
+// NewFileState describes a file with the given content and modification time.
+func NewFileState(document []byte, modTime time.Time) FileState {
+	sum := sha256.Sum256(document)
+	return FileState{
+		Size:    int64(len(document)),
+		ModTime: modTime,
+		Hash:    hex.EncodeToString(sum[:]),
+	}
+}
+
+// Matches is the cheap check whether a file is unchanged: its size and
+// modification time are the same.
+func (s FileState) Matches(info fs.FileInfo) bool {
+	return s.Size == info.Size() && s.ModTime.Equal(info.ModTime())
+}
+
+// SameContent reports whether two states have the same content.
+func (s FileState) SameContent(o FileState) bool {
+	return s.Size == o.Size && s.Hash == o.Hash
+}
+
 type Cache interface {
-	SaveNote(path Path, forwardLinks []Link, metaData Metadata, saveTime time.Time) error
+	SaveNote(path Path, forwardLinks []Link, metaData Metadata, state FileState) error
+	SetFileState(path Path, state FileState) error
 	EditNote(path Path, forwardLinks []Link, metaData Metadata) error
 	DiscardNote(path Path) error
 	DeleteNote(path Path) error
+	RenameNote(oldPath, newPath Path) error
 	GetPaths() []Path
-	GetSaveTime(path Path) time.Time
+	GetFileState(path Path) (FileState, bool)
 	NoteExists(path Path) bool
 	GetForwardLinks(path Path) ([]Link, error)
 	GetBackLinks(path Path) ([]Link, error)
 	GetMetaData(path Path) (Metadata, error)
-	Subscribe(ctx context.Context) (<-chan Event, error)
+	Topology() *Topology
+	Subscribe(ctx context.Context, opts SubscribeOptions) (<-chan Event, error)
+	Generation() uint64
 	Dump() []byte
 }
 
 type cache struct {
 	mu              sync.RWMutex
+	generation      uint64             // counts the changes to the dumped state
 	graph           Graph              `json:"-"`
+	Version         int                `json:"version"`
 	SavedNotes      map[Path][]Link    `json:"saved_notes"`
-	SaveTimes       map[Path]time.Time `json:"save_times"`
+	FileStates      map[Path]FileState `json:"file_states"`
 	SavedMetaData   map[Path]Metadata  `json:"metadata"`
 	CurrentMetaData map[Path]Metadata  `json:"-"`
 }
 
 func NewCache() Cache {
 	return &cache{
+		Version:         SchemaVersion,
 		graph:           NewGraph(),
 		SavedNotes:      make(map[Path][]Link),
-		SaveTimes:       make(map[Path]time.Time),
+		FileStates:      make(map[Path]FileState),
 		SavedMetaData:   make(map[Path]Metadata),
 		CurrentMetaData: make(map[Path]Metadata),
 	}
 }
 
 // RestoreCache takes a JSON dump (produced by Dump) and rebuilds both the maps and the graph by replaying SaveNote.
+// Dumps of earlier schema versions are migrated first.
 func RestoreCache(dump []byte) (Cache, error) {
+	dump, err := migrate(dump)
+	if err != nil {
+		return nil, err
+	}
 	c := cache{}
 	if err := json.Unmarshal(dump, &c); err != nil {
 		return nil, err
@@ -53,8 +96,8 @@ func RestoreCache(dump []byte) (Cache, error) {
 	if c.SavedNotes == nil {
 		c.SavedNotes = make(map[Path][]Link)
 	}
-	if c.SaveTimes == nil {
-		c.SaveTimes = make(map[Path]time.Time)
+	if c.FileStates == nil {
+		c.FileStates = make(map[Path]FileState)
 	}
 	if c.SavedMetaData == nil {
 		c.SavedMetaData = make(map[Path]Metadata)
@@ -71,9 +114,12 @@ func RestoreCache(dump []byte) (Cache, error) {
 
 	c.graph = NewGraph()
 	for path, links := range c.SavedNotes {
-		_, ok := c.SaveTimes[path]
-		if !ok {
-			return nil, errors.New("missing save-time for " + string(path))
+		// Without a file state, the note is parsed again on the next scan.
+		if _, ok := c.FileStates[path]; !ok {
+			delete(c.SavedNotes, path)
+			delete(c.SavedMetaData, path)
+			delete(c.CurrentMetaData, path)
+			continue
 		}
 		if err := c.graph.UpsertNote(path, links, c.SavedMetaData[path]); err != nil {
 			return nil, err
@@ -83,12 +129,12 @@ func RestoreCache(dump []byte) (Cache, error) {
 	return &c, nil
 }
 
-// SaveNote commits a note's links, save time, and metadata.
+// SaveNote commits a note's links, file state, and metadata.
 func (c *cache) SaveNote(
 	path Path,
 	forwardLinks []Link,
 	metaData Metadata,
-	saveTime time.Time,
+	state FileState,
 ) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -96,9 +142,10 @@ func (c *cache) SaveNote(
 	if err := c.graph.UpsertNote(path, forwardLinks, metaData); err != nil {
 		return err
 	}
-	// commit links and time
+	// commit links and file state
 	c.SavedNotes[path] = forwardLinks
-	c.SaveTimes[path] = saveTime
+	c.FileStates[path] = state
+	c.generation++
 	// commit metadata
 	mCopy := make(map[string]string, len(metaData))
 	for k, v := range metaData {
@@ -109,15 +156,14 @@ func (c *cache) SaveNote(
 	return nil
 }
 
-// EditNote updates a note's links and staging metadata without changing the save time or saved state.
+// EditNote updates a note's links and staging metadata without changing the file state or saved state.
+// Edits are not dumped, since the file may never be saved.
 func (c *cache) EditNote(path Path, forwardLinks []Link, metaData map[string]string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if err := c.graph.UpsertNote(path, forwardLinks, metaData); err != nil {
 		return err
 	}
-	// update saved-links view
-	c.SavedNotes[path] = forwardLinks
 	// update staging metadata
 	mCopy := make(map[string]string, len(metaData))
 	for k, v := range metaData {
@@ -136,9 +182,51 @@ func (c *cache) DeleteNote(path Path) error {
 		return err
 	}
 	delete(c.SavedNotes, path)
-	delete(c.SaveTimes, path)
+	delete(c.FileStates, path)
 	delete(c.SavedMetaData, path)
 	delete(c.CurrentMetaData, path)
+	c.generation++
+	return nil
+}
+
+// RenameNote moves a note, its saved state and all links from or to it.
+func (c *cache) RenameNote(oldPath, newPath Path) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.graph.RenameNote(oldPath, newPath); err != nil {
+		return err
+	}
+	if links, ok := c.SavedNotes[oldPath]; ok {
+		delete(c.SavedNotes, oldPath)
+		c.SavedNotes[newPath] = links
+	}
+	for src, links := range c.SavedNotes {
+		moved := make([]Link, len(links))
+		for i, l := range links {
+			if l.Source == oldPath {
+				l.Source = newPath
+			}
+			if l.Target == oldPath {
+				l.Target = newPath
+			}
+			moved[i] = l
+		}
+		c.SavedNotes[src] = moved
+	}
+	if s, ok := c.FileStates[oldPath]; ok {
+		delete(c.FileStates, oldPath)
+		c.FileStates[newPath] = s
+	}
+	if m, ok := c.SavedMetaData[oldPath]; ok {
+		delete(c.SavedMetaData, oldPath)
+		c.SavedMetaData[newPath] = m
+	}
+	if m, ok := c.CurrentMetaData[oldPath]; ok {
+		delete(c.CurrentMetaData, oldPath)
+		c.CurrentMetaData[newPath] = m
+	}
+	c.generation++
 	return nil
 }
 
@@ -190,15 +278,27 @@ func (c *cache) NoteExists(path Path) bool {
 	return !placeholder
 }
 
-func (c *cache) GetSaveTime(path Path) time.Time {
+// SetFileState records a new file state for a saved note whose content did
+// not change, such as after a touch or a checkout.
+func (c *cache) SetFileState(path Path, state FileState) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.FileStates[path]; !ok {
+		return ErrNoteNotFound
+	}
+	c.FileStates[path] = state
+	c.generation++
+	return nil
+}
+
+// GetFileState returns the state of a note's file when it was last saved.
+func (c *cache) GetFileState(path Path) (FileState, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	t, ok := c.SaveTimes[path]
-	if !ok {
-		return time.Time{}
-	}
-	return t
+	s, ok := c.FileStates[path]
+	return s, ok
 }
 
 func (c *cache) GetForwardLinks(path Path) ([]Link, error) {
@@ -221,8 +321,20 @@ func (c *cache) GetMetaData(path Path) (Metadata, error) {
 	return m, nil
 }
 
-func (c *cache) Subscribe(ctx context.Context) (<-chan Event, error) {
-	return c.graph.Subscribe(ctx)
+func (c *cache) Topology() *Topology {
+	return c.graph.Topology()
+}
+
+func (c *cache) Subscribe(ctx context.Context, opts SubscribeOptions) (<-chan Event, error) {
+	return c.graph.Subscribe(ctx, opts)
+}
+
+// Generation changes whenever the state written by Dump changes, so that
+// unchanged caches need not be written again.
+func (c *cache) Generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
 }
 
 func (c *cache) Dump() []byte {
@@ -0,0 +1,130 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+	"zeta/internal/cache"
+)
+
+func TestFileStates(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state := cache.NewFileState([]byte("= Note"), modTime)
+
+	c := cache.NewCache()
+	if err := c.SaveNote("a.typ", nil, nil, state); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := cache.RestoreCache(c.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := restored.GetFileState("a.typ")
+	if !ok || got.Hash != state.Hash || !got.ModTime.Equal(modTime) {
+		t.Fatalf("restored state %+v, want %+v", got, state)
+	}
+
+	// A checkout that rewrites the same content only moves the mtime.
+	touched := cache.NewFileState([]byte("= Note"), modTime.Add(time.Hour))
+	if !touched.SameContent(state) {
+		t.Error("same content with another mtime differs")
+	}
+	if cache.NewFileState([]byte("= Other"), modTime).SameContent(state) {
+		t.Error("different content is the same")
+	}
+	if err := restored.SetFileState("a.typ", touched); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := restored.GetFileState("a.typ"); !got.ModTime.Equal(touched.ModTime) {
+		t.Errorf("mtime %v, want %v", got.ModTime, touched.ModTime)
+	}
+	if err := restored.SetFileState("b.typ", touched); err != cache.ErrNoteNotFound {
+		t.Errorf("SetFileState on a missing note: got %v, want %v", err, cache.ErrNoteNotFound)
+	}
+}
+
+func TestRestoreMigratesVersion1(t *testing.T) {
+	v1 := `{
+		"saved_notes": {"a.typ": [{"Source": "a.typ", "Target": "b.typ", "Ranges": null}]},
+		"save_times": {"a.typ": "2024-05-01T12:00:00Z"},
+		"metadata": {"a.typ": {"title": "A"}}
+	}`
+	c, err := cache.RestoreCache([]byte(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := c.GetBackLinks("b.typ")
+	if err != nil || len(links) != 1 {
+		t.Fatalf("backlinks of b.typ: %v, %v", links, err)
+	}
+	// Migrated notes are parsed again on the next scan.
+	state, ok := c.GetFileState("a.typ")
+	if !ok || state.SameContent(cache.NewFileState(nil, state.ModTime)) {
+		t.Errorf("migrated state %+v matches a file", state)
+	}
+	if c.Generation() != 0 {
+		t.Errorf("restored cache has changes")
+	}
+
+	if _, err := cache.RestoreCache([]byte(`{"version": 99}`)); err == nil {
+		t.Error("restored a dump of an unknown version")
+	}
+}
+
+func TestDumpLeavesOutEdits(t *testing.T) {
+	state := cache.NewFileState([]byte("= Note"), time.Now())
+	c := cache.NewCache()
+	if err := c.SaveNote("a.typ", nil, nil, state); err != nil {
+		t.Fatal(err)
+	}
+	generation := c.Generation()
+
+	// A note opened before it is saved, and an edit closed without saving.
+	links := []cache.Link{{Source: "new.typ", Target: "a.typ"}}
+	if err := c.EditNote("new.typ", links, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.EditNote("a.typ", []cache.Link{{Source: "a.typ", Target: "new.typ"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DiscardNote("a.typ"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Generation() != generation {
+		t.Errorf("edits changed the generation from %d to %d", generation, c.Generation())
+	}
+
+	restored, err := cache.RestoreCache(c.Dump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.NoteExists("new.typ") {
+		t.Error("restored the unsaved new.typ")
+	}
+	if links, _ := restored.GetForwardLinks("a.typ"); len(links) != 0 {
+		t.Errorf("restored the discarded links %v of a.typ", links)
+	}
+	if _, ok := restored.GetFileState("a.typ"); !ok {
+		t.Error("lost the saved a.typ")
+	}
+}
+
+func TestRestoreSkipsNotesWithoutState(t *testing.T) {
+	dump := `{
+		"version": 2,
+		"saved_notes": {
+			"a.typ": [{"Source": "a.typ", "Target": "b.typ", "Ranges": null}],
+			"b.typ": []
+		},
+		"file_states": {"b.typ": {"size": 0, "mod_time": "2024-05-01T12:00:00Z", "hash": ""}}
+	}`
+	c, err := cache.RestoreCache([]byte(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.NoteExists("a.typ") {
+		t.Error("restored a.typ without its file state")
+	}
+	if !c.NoteExists("b.typ") {
+		t.Error("lost b.typ")
+	}
+}
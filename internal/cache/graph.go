@@ -8,22 +8,22 @@ import (
 // In-memory implementation of Cache interface.
 // Uses maps for fast lookups.
 type graph struct {
-	mu          sync.RWMutex
-	notes       map[Path]*Note
-	forward     map[Path]map[Path]Link
-	backlinks   map[Path]map[Path]Link
-	subscribers map[int]chan Event
-	nextSubID   int
+	mu        sync.RWMutex
+	notes     map[Path]*Note
+	forward   map[Path]map[Path]Link
+	backlinks map[Path]map[Path]Link
+	bus       *bus
 }
 
 // NewGraph creates a new in-memory Graph.
 func NewGraph() Graph {
-	return &graph{
-		notes:       make(map[Path]*Note),
-		forward:     make(map[Path]map[Path]Link),
-		backlinks:   make(map[Path]map[Path]Link),
-		subscribers: make(map[int]chan Event),
+	g := &graph{
+		notes:     make(map[Path]*Note),
+		forward:   make(map[Path]map[Path]Link),
+		backlinks: make(map[Path]map[Path]Link),
 	}
+	g.bus = newBus(g.mu.RLocker(), g.snapshot)
+	return g
 }
 
 // UpsertNote inserts or updates a note, diffing links and emitting events only on topology or metadata changes.
@@ -232,6 +232,101 @@ func (g *graph) DeleteNote(path Path) error {
 	return nil
 }
 
+// RenameNote moves a note and all of its links to a new path, emitting a
+// single UpdateNote event. A placeholder at the new path is merged into the
+// moved note.
+func (g *graph) RenameNote(oldPath, newPath Path) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n, exists := g.notes[oldPath]
+	if !exists {
+		return ErrNoteNotFound
+	}
+	if oldPath == newPath {
+		return nil
+	}
+
+	// Drop a placeholder at the new path, remembering who linked to it.
+	var merged map[Path]Link
+	if existing, ok := g.notes[newPath]; ok {
+		if !existing.Placeholder {
+			return ErrNoteExists
+		}
+		merged = g.backlinks[newPath]
+		for src := range merged {
+			delete(g.forward[src], newPath)
+			g.emit(Event{Type: DeleteLink, Link: &LinkEvent{Source: src, Target: newPath}})
+		}
+		delete(g.backlinks, newPath)
+		delete(g.notes, newPath)
+		g.emit(Event{Type: DeleteNote, Note: &NoteEvent{Path: newPath, Placeholder: true}})
+	}
+
+	// Move the note itself.
+	delete(g.notes, oldPath)
+	n.Path = newPath
+	g.notes[newPath] = n
+	g.emit(
+		Event{
+			Type: UpdateNote,
+			Note: &NoteEvent{Path: oldPath, NewPath: newPath, Placeholder: n.Placeholder, Metadata: n.Metadata},
+		},
+	)
+
+	// Move outgoing links.
+	if fl := g.forward[oldPath]; fl != nil {
+		moved := make(map[Path]Link, len(fl))
+		for tgt, l := range fl {
+			delete(g.backlinks[tgt], oldPath)
+			l.Source = newPath
+			if tgt == oldPath {
+				tgt, l.Target = newPath, newPath
+			}
+			moved[tgt] = l
+		}
+		delete(g.forward, oldPath)
+		g.forward[newPath] = moved
+		for tgt, l := range moved {
+			if g.backlinks[tgt] == nil {
+				g.backlinks[tgt] = make(map[Path]Link)
+			}
+			g.backlinks[tgt][newPath] = l
+		}
+	}
+
+	// Move incoming links.
+	if bl := g.backlinks[oldPath]; bl != nil {
+		delete(g.backlinks, oldPath)
+		if g.backlinks[newPath] == nil {
+			g.backlinks[newPath] = make(map[Path]Link)
+		}
+		for src, l := range bl {
+			if src == oldPath {
+				continue // a link to itself moved with the outgoing links
+			}
+			l.Target = newPath
+			delete(g.forward[src], oldPath)
+			g.forward[src][newPath] = l
+			g.backlinks[newPath][src] = l
+		}
+	}
+
+	// Restore links that pointed to the dropped placeholder.
+	for src, l := range merged {
+		if src == oldPath {
+			src, l.Source = newPath, newPath
+		}
+		if existing, ok := g.forward[src][newPath]; ok {
+			existing.Ranges = append(existing.Ranges, l.Ranges...)
+			g.forward[src][newPath] = existing
+			g.backlinks[newPath][src] = existing
+			continue
+		}
+		createLink(src, newPath, l, g)
+	}
+	return nil
+}
+
 func (g *graph) GetPaths() []Path {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
@@ -280,57 +375,42 @@ func (g *graph) IsPlaceholder(path Path) (bool, error) {
 	return note.Placeholder, nil
 }
 
-func (g *graph) Subscribe(ctx context.Context) (<-chan Event, error) {
-	g.mu.Lock()
-	ch := make(chan Event, 16)
-	sid := g.nextSubID
-	g.nextSubID++
-	g.subscribers[sid] = ch
+func (g *graph) Topology() *Topology {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	t := NewTopology()
+	for path, note := range g.notes {
+		t.AddNote(path, note.Placeholder)
+	}
+	for source, targets := range g.forward {
+		for target := range targets {
+			t.AddLink(source, target)
+		}
+	}
+	return t
+}
+
+func (g *graph) Subscribe(ctx context.Context, opts SubscribeOptions) (<-chan Event, error) {
+	return g.bus.subscribe(ctx, opts), nil
+}
 
-	notes := make([]*NoteEvent, 0, len(g.notes))
+// snapshot returns the events that create the graph as it is. The caller
+// holds g.mu.
+func (g *graph) snapshot() []Event {
+	events := make([]Event, 0, len(g.notes))
 	for _, note := range g.notes {
 		ev := &NoteEvent{Path: note.Path, Placeholder: note.Placeholder, Metadata: note.Metadata}
-		notes = append(notes, ev)
+		events = append(events, Event{Type: CreateNote, Note: ev})
 	}
-	links := make([]*LinkEvent, 0)
 	for src, targets := range g.forward {
 		for tgt := range targets {
-			links = append(links, &LinkEvent{Source: src, Target: tgt})
+			events = append(events, Event{Type: CreateLink, Link: &LinkEvent{Source: src, Target: tgt}})
 		}
 	}
-	g.mu.Unlock()
-
-	go func() {
-		for _, ne := range notes {
-			select {
-			case ch <- Event{Type: CreateNote, Note: ne}:
-			case <-ctx.Done():
-				return
-			}
-		}
-		for _, le := range links {
-			select {
-			case ch <- Event{Type: CreateLink, Link: le}:
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-
-	go func() {
-		<-ctx.Done()
-		g.mu.Lock()
-		delete(g.subscribers, sid)
-		close(ch)
-		g.mu.Unlock()
-	}()
-
-	return ch, nil
+	return events
 }
 
-// emit sends events to all subscribers (non-blocking).
+// emit publishes an event to all subscribers without blocking.
 func (g *graph) emit(event Event) {
-	for _, ch := range g.subscribers {
-		ch <- event
-	}
+	g.bus.publish(event)
 }
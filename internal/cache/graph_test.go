@@ -0,0 +1,87 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"zeta/internal/cache"
+)
+
+func link(src, tgt cache.Path) cache.Link {
+	return cache.Link{Source: src, Target: tgt}
+}
+
+func TestRenameNote(t *testing.T) {
+	g := cache.NewGraph()
+	g.UpsertNote("a.typ", []cache.Link{link("a.typ", "b.typ")}, nil)
+	g.UpsertNote("b.typ", []cache.Link{link("b.typ", "c.typ")}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, _ := g.Subscribe(ctx, cache.SubscribeOptions{})
+	// drain the snapshot: 3 notes, 2 links
+	for range 5 {
+		<-events
+	}
+
+	if err := g.RenameNote("b.typ", "d.typ"); err != nil {
+		t.Fatal(err)
+	}
+	ev := <-events
+	if ev.Type != cache.UpdateNote || ev.Note.Path != "b.typ" || ev.Note.NewPath != "d.typ" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected extra event %+v", ev)
+	default:
+	}
+
+	fl, _ := g.GetForwardLinks("a.typ")
+	if len(fl) != 1 || fl[0].Target != "d.typ" {
+		t.Fatalf("forward links of a.typ not moved: %+v", fl)
+	}
+	fl, _ = g.GetForwardLinks("d.typ")
+	if len(fl) != 1 || fl[0].Source != "d.typ" || fl[0].Target != "c.typ" {
+		t.Fatalf("forward links of d.typ not moved: %+v", fl)
+	}
+	if bl, _ := g.GetBackLinks("b.typ"); len(bl) != 0 {
+		t.Fatalf("stale backlinks of b.typ: %+v", bl)
+	}
+
+	// A note that links to itself keeps linking to itself.
+	g.UpsertNote("e.typ", []cache.Link{link("e.typ", "e.typ"), link("e.typ", "c.typ")}, nil)
+	if err := g.RenameNote("e.typ", "f.typ"); err != nil {
+		t.Fatal(err)
+	}
+	fl, _ = g.GetForwardLinks("f.typ")
+	if len(fl) != 2 {
+		t.Fatalf("forward links of f.typ not moved: %+v", fl)
+	}
+	bl, _ := g.GetBackLinks("f.typ")
+	if len(bl) != 1 || bl[0].Source != "f.typ" || bl[0].Target != "f.typ" {
+		t.Fatalf("self-link of f.typ not moved: %+v", bl)
+	}
+	if bl, _ := g.GetBackLinks("e.typ"); len(bl) != 0 {
+		t.Fatalf("stale backlinks of e.typ: %+v", bl)
+	}
+}
+
+func TestRenameNoteOntoPlaceholder(t *testing.T) {
+	g := cache.NewGraph()
+	g.UpsertNote("a.typ", []cache.Link{link("a.typ", "b.typ")}, nil)
+	g.UpsertNote("c.typ", nil, nil)
+
+	if err := g.RenameNote("c.typ", "b.typ"); err != nil {
+		t.Fatal(err)
+	}
+	if placeholder, _ := g.IsPlaceholder("b.typ"); placeholder {
+		t.Fatal("b.typ should no longer be a placeholder")
+	}
+	bl, _ := g.GetBackLinks("b.typ")
+	if len(bl) != 1 || bl[0].Source != "a.typ" {
+		t.Fatalf("backlinks of b.typ not merged: %+v", bl)
+	}
+	if err := g.RenameNote("a.typ", "b.typ"); err != cache.ErrNoteExists {
+		t.Fatalf("expected ErrNoteExists, got %v", err)
+	}
+}
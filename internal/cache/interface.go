@@ -36,6 +36,8 @@ const (
 	DeleteNote                  // A Note was removed entirely
 	CreateLink                  // A new Link was added.
 	DeleteLink                  // A Link was removed.
+	Resync                      // Events were missed; a snapshot follows.
+	Dropped                     // Events were missed; the channel closes.
 )
 
 // LinkEvent carries only topology (no Range) for event subscribers.
@@ -58,12 +60,23 @@ type Event struct {
 	Type EventType
 	Note *NoteEvent // Populated for note events.
 	Link *LinkEvent // Populated for link events.
+
+	// Seq numbers the events of a graph, starting at 1. Snapshot events
+	// carry the number of the last event they include, so any event tells
+	// where to resume a subscription.
+	Seq uint64
+	// Epoch identifies the graph that numbered the event. The numbers of
+	// different graphs, such as a cache reopened from disk, do not compare.
+	Epoch uint64
+
+	Missed int // Populated for Resync and Dropped events.
 }
 
 // Predefined errors returned by cache operations.
 var (
 	ErrInvalidLink  = errors.New("cache: invalid link; source does not match")
 	ErrNoteNotFound = errors.New("cache: note not found")
+	ErrNoteExists   = errors.New("cache: note already exists")
 )
 
 type Graph interface {
@@ -73,6 +86,9 @@ type Graph interface {
 	// DeleteNote deletes a note or marks is missing if it has backlinks.
 	DeleteNote(path Path) error
 
+	// RenameNote moves a note and its links to a new path.
+	RenameNote(oldPath, newPath Path) error
+
 	// GetPaths returns all cached note paths.
 	GetPaths() []Path
 
@@ -84,7 +100,12 @@ type Graph interface {
 
 	IsPlaceholder(path Path) (bool, error)
 
+	// Topology copies the notes and links for queries.
+	Topology() *Topology
+
 	// Subscribe returns a channel of change events until ctx is canceled.
-	// Callers must drain the channel to avoid blocking.
-	Subscribe(ctx context.Context) (<-chan Event, error)
+	// It starts with a snapshot of the graph, or with the events after
+	// opts.Since. Slow subscribers never block the graph, but miss events
+	// as set by the options.
+	Subscribe(ctx context.Context, opts SubscribeOptions) (<-chan Event, error)
 }
@@ -0,0 +1,439 @@
+package cache
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// Direction selects which links a traversal follows.
+type Direction int
+
+const (
+	Both     Direction = iota // Links in either direction.
+	Outgoing                  // Forward links only.
+	Incoming                  // Backlinks only.
+)
+
+// Topology is a copy of the notes and links of a graph that queries run on,
+// so that a query sees one consistent state without holding any lock.
+type Topology struct {
+	placeholder map[Path]bool // every note, and whether it is a placeholder
+	out         map[Path]map[Path]bool
+	in          map[Path]map[Path]bool
+}
+
+// Hop is a note at some distance from where a traversal started.
+type Hop struct {
+	Path     Path
+	Distance int
+}
+
+// Ranked is a note with a score, such as its in-degree or PageRank.
+type Ranked struct {
+	Path  Path
+	Score float64
+}
+
+// NewTopology returns an empty Topology.
+func NewTopology() *Topology {
+	return &Topology{
+		placeholder: map[Path]bool{},
+		out:         map[Path]map[Path]bool{},
+		in:          map[Path]map[Path]bool{},
+	}
+}
+
+// AddNote adds a note. A note added both as a placeholder and as a note is a
+// note.
+func (t *Topology) AddNote(path Path, placeholder bool) {
+	if p, ok := t.placeholder[path]; ok {
+		placeholder = placeholder && p
+	}
+	t.placeholder[path] = placeholder
+}
+
+// AddLink adds a link between two notes, adding the notes as placeholders
+// if they are missing. Links from a note to itself are ignored.
+func (t *Topology) AddLink(source, target Path) {
+	if source == target {
+		return
+	}
+	t.AddNote(source, true)
+	t.AddNote(target, true)
+	if t.out[source] == nil {
+		t.out[source] = map[Path]bool{}
+	}
+	t.out[source][target] = true
+	if t.in[target] == nil {
+		t.in[target] = map[Path]bool{}
+	}
+	t.in[target][source] = true
+}
+
+// Merge adds the notes and links of another topology, with every path
+// mapped by key. It merges the graphs of several vaults into one.
+func (t *Topology) Merge(o *Topology, key func(Path) Path) {
+	for path, placeholder := range o.placeholder {
+		t.AddNote(key(path), placeholder)
+	}
+	for source, targets := range o.out {
+		for target := range targets {
+			t.AddLink(key(source), key(target))
+		}
+	}
+}
+
+// Notes returns all paths, placeholders included, in order.
+func (t *Topology) Notes() []Path {
+	paths := make([]Path, 0, len(t.placeholder))
+	for path := range t.placeholder {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// IsPlaceholder reports whether a path is only known from links to it.
+func (t *Topology) IsPlaceholder(path Path) bool {
+	return t.placeholder[path]
+}
+
+// neighbours returns the notes one link away in the given direction.
+func (t *Topology) neighbours(path Path, dir Direction) []Path {
+	var paths []Path
+	if dir != Incoming {
+		for target := range t.out[path] {
+			paths = append(paths, target)
+		}
+	}
+	if dir != Outgoing {
+		for source := range t.in[path] {
+			if dir == Incoming || !t.out[path][source] {
+				paths = append(paths, source)
+			}
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// Neighbourhood returns the notes at most hops links away from a note,
+// nearest first, without the note itself.
+func (t *Topology) Neighbourhood(path Path, hops int, dir Direction) ([]Hop, error) {
+	if _, ok := t.placeholder[path]; !ok {
+		return nil, ErrNoteNotFound
+	}
+	distance := map[Path]int{path: 0}
+	frontier := []Path{path}
+	result := []Hop{} // empty, not nil
+	for d := 1; d <= hops && len(frontier) > 0; d++ {
+		var next []Path
+		for _, p := range frontier {
+			for _, n := range t.neighbours(p, dir) {
+				if _, seen := distance[n]; seen {
+					continue
+				}
+				distance[n] = d
+				next = append(next, n)
+				result = append(result, Hop{Path: n, Distance: d})
+			}
+		}
+		frontier = next
+	}
+	slices.SortStableFunc(result, func(a, b Hop) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(a.Path, b.Path))
+	})
+	return result, nil
+}
+
+// ShortestPath returns the notes on a shortest path between two notes, both
+// included, or nil if there is none.
+func (t *Topology) ShortestPath(from, to Path, dir Direction) ([]Path, error) {
+	for _, p := range []Path{from, to} {
+		if _, ok := t.placeholder[p]; !ok {
+			return nil, ErrNoteNotFound
+		}
+	}
+	previous := map[Path]Path{from: from}
+	frontier := []Path{from}
+	for len(frontier) > 0 {
+		var next []Path
+		for _, p := range frontier {
+			for _, n := range t.neighbours(p, dir) {
+				if _, seen := previous[n]; seen {
+					continue
+				}
+				previous[n] = p
+				next = append(next, n)
+			}
+		}
+		frontier = next
+		if _, found := previous[to]; found {
+			break
+		}
+	}
+	if _, found := previous[to]; !found {
+		return nil, nil
+	}
+	path := []Path{to}
+	for p := to; p != from; {
+		p = previous[p]
+		path = append(path, p)
+	}
+	slices.Reverse(path)
+	return path, nil
+}
+
+// Components returns the groups of notes connected by links in either
+// direction, largest first.
+func (t *Topology) Components() [][]Path {
+	seen := map[Path]bool{}
+	var components [][]Path
+	for _, start := range t.Notes() {
+		if seen[start] {
+			continue
+		}
+		seen[start] = true
+		component := []Path{start}
+		for i := 0; i < len(component); i++ {
+			for _, n := range t.neighbours(component[i], Both) {
+				if !seen[n] {
+					seen[n] = true
+					component = append(component, n)
+				}
+			}
+		}
+		slices.Sort(component)
+		components = append(components, component)
+	}
+	sortGroups(components)
+	return components
+}
+
+// StronglyConnected returns the groups of notes that all reach each other
+// through forward links, largest first. Notes in no cycle are left out.
+func (t *Topology) StronglyConnected() [][]Path {
+	// Tarjan's algorithm, with an explicit stack so that long chains of
+	// notes cannot exhaust the goroutine stack.
+	type frame struct {
+		path    Path
+		targets []Path
+		next    int
+	}
+	index := map[Path]int{}
+	lowlink := map[Path]int{}
+	onStack := map[Path]bool{}
+	var stack []Path
+	var groups [][]Path
+
+	for _, root := range t.Notes() {
+		if _, visited := index[root]; visited {
+			continue
+		}
+		frames := []frame{{path: root, targets: t.neighbours(root, Outgoing)}}
+		index[root], lowlink[root] = len(index), len(index)
+		stack = append(stack, root)
+		onStack[root] = true
+
+		for len(frames) > 0 {
+			f := &frames[len(frames)-1]
+			if f.next < len(f.targets) {
+				n := f.targets[f.next]
+				f.next++
+				if _, visited := index[n]; !visited {
+					index[n], lowlink[n] = len(index), len(index)
+					stack = append(stack, n)
+					onStack[n] = true
+					frames = append(frames, frame{path: n, targets: t.neighbours(n, Outgoing)})
+				} else if onStack[n] {
+					lowlink[f.path] = min(lowlink[f.path], index[n])
+				}
+				continue
+			}
+
+			p := f.path
+			frames = frames[:len(frames)-1]
+			if len(frames) > 0 {
+				parent := frames[len(frames)-1].path
+				lowlink[parent] = min(lowlink[parent], lowlink[p])
+			}
+			if lowlink[p] != index[p] {
+				continue
+			}
+			i := len(stack) - 1
+			for stack[i] != p {
+				i--
+			}
+			group := slices.Clone(stack[i:])
+			for _, n := range group {
+				onStack[n] = false
+			}
+			stack = stack[:i]
+			if len(group) > 1 {
+				slices.Sort(group)
+				groups = append(groups, group)
+			}
+		}
+	}
+	sortGroups(groups)
+	return groups
+}
+
+// sortGroups orders groups of sorted paths by size, largest first.
+func sortGroups(groups [][]Path) {
+	slices.SortFunc(groups, func(a, b []Path) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), cmp.Compare(a[0], b[0]))
+	})
+}
+
+// Orphans returns the notes that neither link to nor are linked from any
+// other note.
+func (t *Topology) Orphans() []Path {
+	paths := []Path{} // empty, not nil
+	for _, path := range t.Notes() {
+		if !t.placeholder[path] && len(t.out[path]) == 0 && len(t.in[path]) == 0 {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Leaves returns the notes that are linked from other notes but link to
+// none themselves. Placeholders, which never link anywhere, are left out.
+func (t *Topology) Leaves() []Path {
+	paths := []Path{} // empty, not nil
+	for _, path := range t.Notes() {
+		if !t.placeholder[path] && len(t.out[path]) == 0 && len(t.in[path]) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Orphan is a note that is cut off from the other notes in some way.
+type Orphan struct {
+	Path             Path
+	NoBacklinks      bool // No note links to it.
+	NoLinks          bool // It links to no note.
+	OnlyPlaceholders bool // It links only to notes that do not exist.
+}
+
+// Reasons why a note is in the orphan report.
+const (
+	ReasonNoBacklinks      = "no_backlinks"
+	ReasonNoLinks          = "no_links"
+	ReasonOnlyPlaceholders = "only_placeholders"
+)
+
+// Reasons lists why a note is in the orphan report.
+func (o Orphan) Reasons() []string {
+	var reasons []string
+	if o.NoBacklinks {
+		reasons = append(reasons, ReasonNoBacklinks)
+	}
+	if o.NoLinks {
+		reasons = append(reasons, ReasonNoLinks)
+	}
+	if o.OnlyPlaceholders {
+		reasons = append(reasons, ReasonOnlyPlaceholders)
+	}
+	return reasons
+}
+
+// OrphanReport returns the notes, placeholders aside, that are not linked
+// from any note or do not link to any existing note.
+func (t *Topology) OrphanReport() []Orphan {
+	report := []Orphan{} // empty, not nil
+	for _, path := range t.Notes() {
+		if t.placeholder[path] {
+			continue
+		}
+		o := Orphan{
+			Path:        path,
+			NoBacklinks: len(t.in[path]) == 0,
+			NoLinks:     len(t.out[path]) == 0,
+		}
+		if !o.NoLinks {
+			o.OnlyPlaceholders = true
+			for target := range t.out[path] {
+				if !t.placeholder[target] {
+					o.OnlyPlaceholders = false
+					break
+				}
+			}
+		}
+		if o.NoBacklinks || o.NoLinks || o.OnlyPlaceholders {
+			report = append(report, o)
+		}
+	}
+	return report
+}
+
+// InDegree ranks the notes by the number of notes linking to them.
+func (t *Topology) InDegree() []Ranked {
+	ranking := make([]Ranked, 0, len(t.placeholder))
+	for path := range t.placeholder {
+		ranking = append(ranking, Ranked{Path: path, Score: float64(len(t.in[path]))})
+	}
+	sortRanking(ranking)
+	return ranking
+}
+
+const (
+	pageRankDamping    = 0.85
+	pageRankIterations = 100
+	pageRankTolerance  = 1e-9
+)
+
+// PageRank ranks the notes by PageRank over the forward links. The scores
+// sum to one.
+func (t *Topology) PageRank() []Ranked {
+	paths := t.Notes()
+	n := float64(len(paths))
+	if n == 0 {
+		return []Ranked{} // empty, not nil
+	}
+	rank := make(map[Path]float64, len(paths))
+	for _, p := range paths {
+		rank[p] = 1 / n
+	}
+
+	for range pageRankIterations {
+		// Notes without forward links spread their rank over all notes.
+		var dangling float64
+		for _, p := range paths {
+			if len(t.out[p]) == 0 {
+				dangling += rank[p]
+			}
+		}
+		next := make(map[Path]float64, len(paths))
+		var delta float64
+		for _, p := range paths {
+			score := (1-pageRankDamping)/n + pageRankDamping*dangling/n
+			for source := range t.in[p] {
+				score += pageRankDamping * rank[source] / float64(len(t.out[source]))
+			}
+			next[p] = score
+			delta += math.Abs(score - rank[p])
+		}
+		rank = next
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+
+	ranking := make([]Ranked, 0, len(paths))
+	for _, p := range paths {
+		ranking = append(ranking, Ranked{Path: p, Score: rank[p]})
+	}
+	sortRanking(ranking)
+	return ranking
+}
+
+// sortRanking orders a ranking by score, highest first.
+func sortRanking(ranking []Ranked) {
+	slices.SortFunc(ranking, func(a, b Ranked) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.Path, b.Path))
+	})
+}
@@ -0,0 +1,97 @@
+package cache_test
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"zeta/internal/cache"
+)
+
+// a → b → c → a is a cycle, c → d a way out of it, and e stands alone.
+// f links to the missing note g.
+func queryGraph() *cache.Topology {
+	g := cache.NewGraph()
+	g.UpsertNote("a", []cache.Link{link("a", "b")}, nil)
+	g.UpsertNote("b", []cache.Link{link("b", "c")}, nil)
+	g.UpsertNote("c", []cache.Link{link("c", "a"), link("c", "d")}, nil)
+	g.UpsertNote("d", nil, nil)
+	g.UpsertNote("e", nil, nil)
+	g.UpsertNote("f", []cache.Link{link("f", "g")}, nil)
+	return g.Topology()
+}
+
+func TestTraversals(t *testing.T) {
+	topo := queryGraph()
+
+	hops, err := topo.Neighbourhood("a", 2, cache.Both)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cache.Hop{{"b", 1}, {"c", 1}, {"d", 2}}
+	if !slices.Equal(hops, want) {
+		t.Errorf("neighbourhood of a: %v, want %v", hops, want)
+	}
+	if _, err := topo.Neighbourhood("x", 1, cache.Both); err != cache.ErrNoteNotFound {
+		t.Errorf("neighbourhood of a missing note: %v", err)
+	}
+
+	path, _ := topo.ShortestPath("a", "d", cache.Outgoing)
+	if !slices.Equal(path, []cache.Path{"a", "b", "c", "d"}) {
+		t.Errorf("path from a to d: %v", path)
+	}
+	if path, _ := topo.ShortestPath("d", "a", cache.Outgoing); path != nil {
+		t.Errorf("path from d to a against the links: %v", path)
+	}
+	if path, _ := topo.ShortestPath("d", "a", cache.Both); !slices.Equal(path, []cache.Path{"d", "c", "a"}) {
+		t.Errorf("undirected path from d to a: %v", path)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	topo := queryGraph()
+
+	components := topo.Components()
+	if len(components) != 3 || !slices.Equal(components[0], []cache.Path{"a", "b", "c", "d"}) {
+		t.Errorf("components: %v", components)
+	}
+	scc := topo.StronglyConnected()
+	if len(scc) != 1 || !slices.Equal(scc[0], []cache.Path{"a", "b", "c"}) {
+		t.Errorf("strongly connected: %v", scc)
+	}
+	if orphans := topo.Orphans(); !slices.Equal(orphans, []cache.Path{"e"}) {
+		t.Errorf("orphans: %v", orphans)
+	}
+	if leaves := topo.Leaves(); !slices.Equal(leaves, []cache.Path{"d"}) {
+		t.Errorf("leaves: %v", leaves)
+	}
+
+	report := topo.OrphanReport()
+	want := []cache.Orphan{
+		{Path: "d", NoLinks: true},
+		{Path: "e", NoBacklinks: true, NoLinks: true},
+		{Path: "f", NoBacklinks: true, OnlyPlaceholders: true},
+	}
+	if !slices.Equal(report, want) {
+		t.Errorf("orphan report: %+v, want %+v", report, want)
+	}
+}
+
+func TestRankings(t *testing.T) {
+	topo := queryGraph()
+
+	// Every linked note has one backlink, and ties are ordered by path.
+	if top := topo.InDegree()[0]; top.Path != "a" || top.Score != 1 {
+		t.Errorf("top in-degree: %+v", top)
+	}
+	ranking := topo.PageRank()
+	var sum float64
+	for _, r := range ranking {
+		sum += r.Score
+	}
+	if math.Abs(sum-1) > 1e-6 {
+		t.Errorf("PageRank sums to %v", sum)
+	}
+	if ranking[len(ranking)-1].Path != "f" && ranking[len(ranking)-1].Path != "e" {
+		t.Errorf("unlinked notes rank above linked ones: %v", ranking)
+	}
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the version of the format written by Dump. Dumps without
+// a version are version 1.
+const SchemaVersion = 2
+
+// migrations[i] migrates a dump from version i+1 to version i+2.
+var migrations = []func(dump map[string]json.RawMessage) error{
+	// Save times were replaced by file states. A save time says nothing
+	// about the content, so the states match no file and every note is
+	// parsed again, while the links stay available in the meantime.
+	func(dump map[string]json.RawMessage) error {
+		var saveTimes map[Path]time.Time
+		if raw, ok := dump["save_times"]; ok {
+			if err := json.Unmarshal(raw, &saveTimes); err != nil {
+				return err
+			}
+		}
+		states := make(map[Path]FileState, len(saveTimes))
+		for path, t := range saveTimes {
+			states[path] = FileState{Size: -1, ModTime: t}
+		}
+		raw, err := json.Marshal(states)
+		if err != nil {
+			return err
+		}
+		delete(dump, "save_times")
+		dump["file_states"] = raw
+		return nil
+	},
+}
+
+// migrate upgrades a dump of any earlier version to SchemaVersion.
+func migrate(data []byte) ([]byte, error) {
+	var dump map[string]json.RawMessage
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, err
+	}
+	version := 1
+	if raw, ok := dump["version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, err
+		}
+	}
+	if version == SchemaVersion {
+		return data, nil
+	}
+	if version < 1 || version > SchemaVersion {
+		return nil, fmt.Errorf("cache: unknown schema version %d", version)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		if err := migrations[version-1](dump); err != nil {
+			return nil, fmt.Errorf("cache: migrating from version %d: %w", version, err)
+		}
+	}
+	dump["version"], _ = json.Marshal(SchemaVersion)
+	return json.Marshal(dump)
+}
@@ -14,6 +14,15 @@ type Config struct {
 	DefaultExtension   string   `json:"default_extension"`
 	TitleTemplate      string   `json:"title_template"`
 	TitleSubstitutions []string `json:"title_substitutions"`
+	HoverLines         int      `json:"hover_lines"`
+	NoteTemplate       string   `json:"note_template"`
+	OutlineQuery       string   `json:"outline_query"`
+	LinkHints          string   `json:"link_hints"`     // "inlay" or "diagnostic"
+	WatchInterval      int      `json:"watch_interval"` // seconds, 0 disables polling
+	ScanWorkers        int      `json:"scan_workers"`
+	Ignore             []string `json:"ignore"`        // .gitignore-style patterns
+	UseGitignore       bool     `json:"use_gitignore"` // also read the .gitignore
+	OrphanHints        bool     `json:"orphan_hints"`  // hint at notes without backlinks
 }
 
 var defaultConfig = Config{
@@ -24,10 +33,20 @@ var defaultConfig = Config{
 	DefaultExtension:   ".typ",
 	TitleTemplate:      "%s %s %s",
 	TitleSubstitutions: []string{"taxon", "title", "path"},
+	HoverLines:         10,
+	OutlineQuery:       `(heading) @heading`,
+	LinkHints:          "inlay",
+	WatchInterval:      5,
+	ScanWorkers:        4,
 }
 
 func Load(v any) (Config, error) {
-	cfg := defaultConfig
+	return Merge(defaultConfig, v)
+}
+
+// Merge overlays the fields present in v onto base.
+func Merge(base Config, v any) (Config, error) {
+	cfg := base
 
 	data, err := json.Marshal(v)
 	if err != nil {
@@ -3,8 +3,10 @@ package graph
 import (
 	"encoding/json"
 	"log"
+	"math/rand/v2"
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"zeta/external"
 
@@ -23,6 +25,7 @@ type Node struct {
 	ID     int    `json:"id"`
 	Label  string `json:"label"`
 	Grayed bool   `json:"grayed"`
+	Vault  string `json:"vault,omitempty"`
 }
 
 // Link represents a directed edge between two nodes.
@@ -37,6 +40,24 @@ type IncrementalMessage struct {
 	Graph *GraphData `json:"graph,omitempty"` // used for "init"
 	Node  *Node      `json:"node,omitempty"`  // for add/update/deleteNode
 	Link  *Link      `json:"link,omitempty"`  // for add/deleteLink
+
+	// Seq numbers the messages since the graph was reset; "init" carries
+	// the number of the last message it includes. A client that reconnects
+	// to /ws?since=<seq>&epoch=<epoch> gets the messages it missed.
+	Seq   uint64 `json:"seq"`
+	Epoch string `json:"epoch"` // changes with every reset
+}
+
+// historySize is the number of recent messages kept for clients that
+// reconnect. It is also the number of messages queued for a client, so that
+// a replay of the history always fits.
+const historySize = 4096
+
+// client is a viewer connected over WebSocket. Its messages are queued and
+// written by its own goroutine, so a slow viewer does not hold up the graph.
+type client struct {
+	conn *websocket.Conn
+	send chan []byte // closed when the client is dropped
 }
 
 var staticFiles = external.Assets
@@ -44,10 +65,15 @@ var staticFiles = external.Assets
 var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
 
 var (
+	// graphMu also orders the messages, which are numbered and queued
+	// while holding it.
 	graph   = GraphData{Nodes: []Node{}, Links: []Link{}}
 	graphMu sync.Mutex
+	epoch   = newEpoch()
+	seq     uint64
+	history []IncrementalMessage // the last historySize messages
 
-	clients   = make(map[*websocket.Conn]bool)
+	clients   = make(map[*client]bool)
 	clientsMu sync.Mutex
 )
 
@@ -81,8 +107,8 @@ func ShowGraph(addr string) string {
 // AddNode adds a node to the graph and broadcasts the change.
 func AddNode(node Node) error {
 	graphMu.Lock()
+	defer graphMu.Unlock()
 	graph.Nodes = append(graph.Nodes, node)
-	graphMu.Unlock()
 	msg := IncrementalMessage{Op: "add", Node: &node}
 	return broadcastMessage(msg)
 }
@@ -90,13 +116,13 @@ func AddNode(node Node) error {
 // UpdateNode updates an existing node (matched by ID) and broadcasts.
 func UpdateNode(node Node) error {
 	graphMu.Lock()
+	defer graphMu.Unlock()
 	for i, n := range graph.Nodes {
 		if n.ID == node.ID {
 			graph.Nodes[i] = node
 			break
 		}
 	}
-	graphMu.Unlock()
 	msg := IncrementalMessage{Op: "update", Node: &node}
 	return broadcastMessage(msg)
 }
@@ -104,6 +130,7 @@ func UpdateNode(node Node) error {
 // DeleteNode removes a node by ID and broadcasts.
 func DeleteNode(nodeID int) error {
 	graphMu.Lock()
+	defer graphMu.Unlock()
 	// remove node
 	newNodes := make([]Node, 0, len(graph.Nodes))
 	for _, n := range graph.Nodes {
@@ -112,7 +139,6 @@ func DeleteNode(nodeID int) error {
 		}
 	}
 	graph.Nodes = newNodes
-	graphMu.Unlock()
 	msg := IncrementalMessage{Op: "deleteNode", Node: &Node{ID: nodeID}}
 	return broadcastMessage(msg)
 }
@@ -120,8 +146,8 @@ func DeleteNode(nodeID int) error {
 // AddLink adds a link to the graph and broadcasts.
 func AddLink(link Link) error {
 	graphMu.Lock()
+	defer graphMu.Unlock()
 	graph.Links = append(graph.Links, link)
-	graphMu.Unlock()
 	msg := IncrementalMessage{Op: "add", Link: &link}
 	return broadcastMessage(msg)
 }
@@ -129,6 +155,7 @@ func AddLink(link Link) error {
 // DeleteLink removes a link (exact match) and broadcasts.
 func DeleteLink(link Link) error {
 	graphMu.Lock()
+	defer graphMu.Unlock()
 	newLinks := make([]Link, 0, len(graph.Links))
 	for _, l := range graph.Links {
 		if !(l.Source == link.Source && l.Target == link.Target) {
@@ -136,15 +163,29 @@ func DeleteLink(link Link) error {
 		}
 	}
 	graph.Links = newLinks
-	graphMu.Unlock()
 	msg := IncrementalMessage{Op: "deleteLink", Link: &link}
 	return broadcastMessage(msg)
 }
 
+// Reset removes all nodes and links and tells clients to start over.
+func Reset() error {
+	graphMu.Lock()
+	defer graphMu.Unlock()
+	graph = GraphData{Nodes: []Node{}, Links: []Link{}}
+	epoch, seq, history = newEpoch(), 0, nil
+	msg := IncrementalMessage{Op: "init", Graph: &GraphData{Nodes: []Node{}, Links: []Link{}}, Epoch: epoch}
+	return broadcast(msg)
+}
+
 // GetGraph returns a snapshot of the current graph.
 func GetGraph() GraphData {
 	graphMu.Lock()
 	defer graphMu.Unlock()
+	return snapshot()
+}
+
+// snapshot copies the current graph. The caller holds graphMu.
+func snapshot() GraphData {
 	// shallow copy sufficient for read-only
 	copy := GraphData{
 		Nodes: append([]Node{}, graph.Nodes...),
@@ -153,49 +194,102 @@ func GetGraph() GraphData {
 	return copy
 }
 
-// broadcastMessage marshals and sends a message to all clients.
+// newEpoch returns a random epoch, so that clients of an earlier graph or
+// process do not take its numbers for this one's.
+func newEpoch() string {
+	return strconv.FormatUint(rand.Uint64(), 36)
+}
+
+// broadcastMessage numbers a message, keeps it for clients that reconnect
+// and sends it to all clients. The caller holds graphMu.
 func broadcastMessage(msg IncrementalMessage) error {
+	seq++
+	msg.Seq, msg.Epoch = seq, epoch
+	if len(history) == historySize {
+		history = history[1:]
+	}
+	history = append(history, msg)
+	return broadcast(msg)
+}
+
+// broadcast marshals a message and queues it for all clients. Clients whose
+// queue is full are dropped; they can reconnect and catch up from the
+// history. The caller holds graphMu.
+func broadcast(msg IncrementalMessage) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
 	clientsMu.Lock()
 	defer clientsMu.Unlock()
-	for conn := range clients {
-		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-			log.Printf("Broadcast error: %v", err)
-			conn.Close()
-			delete(clients, conn)
+	for c := range clients {
+		select {
+		case c.send <- data:
+		default:
+			log.Printf("Graph viewer %s cannot keep up, dropping it", c.conn.RemoteAddr())
+			drop(c)
 		}
 	}
 	return nil
 }
 
-// handleWS upgrades HTTP connections and sends initial graph state.
+// drop unregisters a client and closes its connection. The caller holds
+// clientsMu.
+func drop(c *client) {
+	if !clients[c] {
+		return
+	}
+	delete(clients, c)
+	close(c.send)
+	c.conn.Close() // unblocks a pending write
+}
+
+// write sends the queued messages to the client until it is dropped or a
+// write fails.
+func (c *client) write() {
+	defer c.conn.Close()
+	for data := range c.send {
+		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			log.Printf("Broadcast error: %v", err)
+			return
+		}
+	}
+}
+
+// handleWS upgrades HTTP connections and sends the initial graph state, or
+// the messages missed since the ones given by the since and epoch
+// parameters.
 func handleWS(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WS upgrade error: %v", err)
 		return
 	}
-	clientsMu.Lock()
-	clients[conn] = true
-	clientsMu.Unlock()
+	c := &client{conn: conn, send: make(chan []byte, historySize)}
+	go c.write()
 	defer func() {
 		clientsMu.Lock()
-		delete(clients, conn)
+		drop(c)
 		clientsMu.Unlock()
-		conn.Close()
 	}()
 
-	// send initial graph
-	state := GetGraph()
-	initMsg := IncrementalMessage{Op: "init", Graph: &state}
-	if data, err := json.Marshal(initMsg); err == nil {
-		_ = conn.WriteMessage(websocket.TextMessage, data)
+	// Queueing the initial messages and registering the client while
+	// holding graphMu makes sure it gets every message after them exactly
+	// once.
+	graphMu.Lock()
+	since, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || r.URL.Query().Get("epoch") != epoch || since > seq || seq-since > uint64(len(history)) {
+		state := snapshot()
+		queueMessage(c, IncrementalMessage{Op: "init", Graph: &state, Seq: seq, Epoch: epoch})
 	} else {
-		log.Printf("Init marshal error: %v", err)
+		for _, msg := range history[len(history)-int(seq-since):] {
+			queueMessage(c, msg)
+		}
 	}
+	clientsMu.Lock()
+	clients[c] = true
+	clientsMu.Unlock()
+	graphMu.Unlock()
 
 	// keep connection open
 	for {
@@ -204,3 +298,14 @@ func handleWS(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// queueMessage queues a message for a client that is not registered yet,
+// whose queue has room for the whole history.
+func queueMessage(c *client, msg IncrementalMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Marshal error: %v", err)
+		return
+	}
+	c.send <- data
+}
@@ -0,0 +1,184 @@
+// ignore matches paths against .gitignore-style patterns.
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Matcher decides which paths a list of patterns excludes. As in
+// .gitignore, later patterns override earlier ones, "!" re-includes a path,
+// a trailing "/" only matches directories and a pattern containing a "/"
+// other than a trailing one is anchored to the root.
+type Matcher struct {
+	rules []rule
+}
+
+type rule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// New compiles patterns into a Matcher. Blank lines and comments starting
+// with "#" are skipped.
+func New(patterns []string) *Matcher {
+	m := &Matcher{}
+	for _, p := range patterns {
+		if r, ok := compile(p); ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return m
+}
+
+// Load builds the Matcher of a vault from, in increasing precedence, its
+// .gitignore if gitignore is set, its .zetaignore and the given patterns.
+func Load(root string, gitignore bool, patterns []string) (*Matcher, error) {
+	var files []string
+	if gitignore {
+		files = append(files, ".gitignore")
+	}
+	files = append(files, ".zetaignore")
+
+	var all []string
+	for _, name := range files {
+		p, err := ReadFile(filepath.Join(root, name))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, p...)
+	}
+	return New(append(all, patterns...)), nil
+}
+
+// ReadFile returns the patterns in an ignore file, one per line. A missing
+// file has no patterns.
+func ReadFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	return patterns, scanner.Err()
+}
+
+// Ignored reports whether a slash-separated path relative to the root is
+// excluded, either itself or through one of its parent directories.
+func (m *Matcher) Ignored(rel string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	rel = strings.Trim(path.Clean(rel), "/")
+	if rel == "." || rel == "" {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+// match applies the rules to a single path. The last matching rule wins.
+func (m *Matcher) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func compile(pattern string) (rule, bool) {
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return rule{}, false
+	}
+	var r rule
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\`) {
+		pattern = pattern[1:] // escaped "#" or "!"
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return rule{}, false
+	}
+
+	var b strings.Builder
+	if strings.Contains(pattern, "/") {
+		b.WriteString("^")
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return rule{}, false
+	}
+	r.re = re
+	return r, true
+}
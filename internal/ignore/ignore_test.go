@@ -0,0 +1,47 @@
+package ignore_test
+
+import (
+	"testing"
+	"zeta/internal/ignore"
+)
+
+func TestIgnored(t *testing.T) {
+	t.Parallel()
+	m := ignore.New([]string{
+		"# build output",
+		"build/",
+		"*.tmp.typ",
+		"/templates",
+		"archive/**/old-*.typ",
+		"drafts/*",
+		"!drafts/keep.typ",
+		`\#literal.typ`,
+	})
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"build", true, true},
+		{"build/out.typ", false, true},
+		{"notes/build/out.typ", false, true},
+		{"build.typ", false, false},
+		{"a.tmp.typ", false, true},
+		{"deep/dir/a.tmp.typ", false, true},
+		{"templates/note.typ", false, true},
+		{"notes/templates/note.typ", false, false},
+		{"archive/old-a.typ", false, true},
+		{"archive/2020/01/old-a.typ", false, true},
+		{"archive/new-a.typ", false, false},
+		{"drafts/idea.typ", false, true},
+		{"drafts/keep.typ", false, false},
+		{"#literal.typ", false, true},
+		{"note.typ", false, false},
+	}
+	for _, test := range tests {
+		if got := m.Ignored(test.path, test.isDir); got != test.want {
+			t.Errorf("Ignored(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
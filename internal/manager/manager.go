@@ -8,24 +8,34 @@ import (
 	"zeta/internal/resolver"
 	"zeta/internal/sitteradapter"
 
+	sitter "github.com/smacker/go-tree-sitter"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
 // DocumentManager encapsulates parser and document state for each open URI.
 type DocumentManager struct {
-	mu      sync.Mutex
-	parsers map[string]*parser.Parser
-	docs    map[string][]byte
+	mu       sync.Mutex
+	resolver *resolver.Resolver
+	parsers  map[string]*parser.Parser
+	docs     map[string][]byte
 }
 
 // NewDocumentManager creates an initialized DocumentManager.
-func NewDocumentManager() *DocumentManager {
+func NewDocumentManager(r *resolver.Resolver) *DocumentManager {
 	return &DocumentManager{
-		parsers: make(map[string]*parser.Parser),
-		docs:    make(map[string][]byte),
+		resolver: r,
+		parsers:  make(map[string]*parser.Parser),
+		docs:     make(map[string][]byte),
 	}
 }
 
+// SetResolver replaces the resolver used to extract links.
+func (dm *DocumentManager) SetResolver(r *resolver.Resolver) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.resolver = r
+}
+
 // EnsureParser returns the parser for a URI, creating it if needed.
 func (dm *DocumentManager) EnsureParser(uri string) (*parser.Parser, error) {
 	dm.mu.Lock()
@@ -55,6 +65,25 @@ func (dm *DocumentManager) GetDocument(uri string) ([]byte, error) {
 	return doc, nil
 }
 
+// IsOpen reports whether a document is loaded for a URI.
+func (dm *DocumentManager) IsOpen(uri string) bool {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	_, ok := dm.docs[uri]
+	return ok
+}
+
+// URIs returns the URIs of all loaded documents.
+func (dm *DocumentManager) URIs() []string {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	uris := make([]string, 0, len(dm.docs))
+	for uri := range dm.docs {
+		uris = append(uris, uri)
+	}
+	return uris
+}
+
 // UpdateDocument replaces the document bytes for a URI.
 func (dm *DocumentManager) UpdateDocument(uri string, content []byte) {
 	dm.mu.Lock()
@@ -87,11 +116,26 @@ func (dm *DocumentManager) ApplyIncrementalEdit(
 	return nil
 }
 
-// GetLinks runs the full parse → query → extract pipeline.
-func (dm *DocumentManager) GetLinksAndMeta(
+// Query parses the current document and runs the query against it.
+// It returns the captured nodes together with the document they refer to.
+func (dm *DocumentManager) Query(
 	uri string,
 	queryString string,
-) ([]cache.Link, map[string]string, error) {
+) (map[string][]*sitter.Node, []byte, error) {
+	results, doc, err := dm.Queries(uri, queryString)
+	if err != nil {
+		return nil, nil, err
+	}
+	return results[0], doc, nil
+}
+
+// Queries parses the current document once and runs every query against
+// it. It returns the captured nodes of each query, in order, together with
+// the document they refer to.
+func (dm *DocumentManager) Queries(
+	uri string,
+	queryStrings ...string,
+) ([]map[string][]*sitter.Node, []byte, error) {
 	// Ensure parser + doc
 	p, err := dm.EnsureParser(uri)
 	if err != nil {
@@ -106,17 +150,36 @@ func (dm *DocumentManager) GetLinksAndMeta(
 	if err := p.Parse(doc); err != nil {
 		return nil, nil, err
 	}
-	nodes, err := p.Query([]byte(queryString), doc)
+	results := make([]map[string][]*sitter.Node, 0, len(queryStrings))
+	for _, q := range queryStrings {
+		nodes, err := p.Query([]byte(q), doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, nodes)
+	}
+	return results, doc, nil
+}
+
+// GetLinks runs the full parse → query → extract pipeline.
+func (dm *DocumentManager) GetLinksAndMeta(
+	uri string,
+	queryString string,
+) ([]cache.Link, map[string]string, error) {
+	nodes, doc, err := dm.Query(uri, queryString)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// Resolve note metadata
-	note, err := resolver.Resolve(uri)
+	dm.mu.Lock()
+	r := dm.resolver
+	dm.mu.Unlock()
+	note, err := r.Resolve(uri)
 	if err != nil {
 		return nil, nil, err
 	}
-	links, meta := resolver.ExtractLinksAndMeta(note, nodes, doc)
+	links, meta := r.ExtractLinksAndMeta(note, nodes, doc)
 	// Extract and return links
 	return links, meta, nil
 }
@@ -147,6 +147,20 @@ func (pp *ParserPool) Close() error {
 	return nil
 }
 
+// CaptureNames returns the names of all captures in the query.
+func CaptureNames(query []byte) ([]string, error) {
+	q, err := sitter.NewQuery(query, lang)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	names := make([]string, 0, q.CaptureCount())
+	for i := range q.CaptureCount() {
+		names = append(names, q.CaptureNameForId(i))
+	}
+	return names, nil
+}
+
 func executeQuery(
 	root *sitter.Node,
 	lang *sitter.Language,
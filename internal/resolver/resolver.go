@@ -1,6 +1,7 @@
 package resolver
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
@@ -8,6 +9,7 @@ import (
 	"regexp"
 	"strings"
 	"zeta/internal/cache"
+	"zeta/internal/ignore"
 	"zeta/internal/sitteradapter"
 
 	sitter "github.com/smacker/go-tree-sitter"
@@ -17,53 +19,108 @@ import (
 type Note struct {
 	URI          protocol.DocumentUri
 	AbsolutePath string
-	RelativePath string
-	CachePath    cache.Path
+	RelativePath string     // relative to the root of its vault
+	CachePath    cache.Path // qualified with the vault if it is not the resolver's
+	Vault        string
 }
 
+// VaultSeparator separates the vault from the path in cross-vault references
+// and cache paths, as in "vault:path/to/note".
+const VaultSeparator = ":"
+
+// Vaults looks up other vaults for cross-vault references.
+type Vaults interface {
+	// Root returns the root of the vault with the given name.
+	Root(name string) (string, bool)
+	// Vault returns the name and root of the vault containing a path.
+	Vault(absolutepath string) (string, string, bool)
+}
+
+// Qualify prefixes a path with its vault.
+func Qualify(vault string, path cache.Path) cache.Path {
+	return vault + VaultSeparator + path
+}
+
+// Errors returned when a reference cannot be resolved.
 var (
-	configured         bool = false
+	ErrInvalidReference   = errors.New("resolver: reference does not match select_regex")
+	ErrEmptyReference     = errors.New("resolver: empty reference")
+	ErrDirectoryReference = errors.New("resolver: cannot reference directories")
+	ErrInvalidExtension   = errors.New("resolver: no valid file extension")
+	ErrIgnored            = errors.New("resolver: path is ignored")
+)
+
+// Resolver maps paths, URIs and references to notes under a root. A
+// Resolver is immutable, so reconfiguring means creating a new one.
+type Resolver struct {
+	name               string
+	vaults             Vaults
+	ignore             *ignore.Matcher
 	root               string
 	selectRegex        *regexp.Regexp
 	fileExtenstions    []string
 	defaultExtension   string
 	titleTemplate      string
 	titleSubstitutions []string
-)
+}
 
-func Configure(
-	configRoot string,
-	configSelectRegex string,
-	configFileExtensions []string,
-	configDefaultExtension string,
-	configTitleTemplate string,
-	configTitleSubstitutions []string,
-) error {
-	if configured {
-		panic("Resolver already configured.")
-	}
-
-	root = configRoot
-	fileExtenstions = configFileExtensions
-	defaultExtension = configDefaultExtension
-	titleTemplate = configTitleTemplate
-	titleSubstitutions = configTitleSubstitutions
-
-	var err error
-	selectRegex, err = regexp.Compile(configSelectRegex)
+// New creates a resolver for the notes under root.
+func New(
+	root string,
+	selectRegex string,
+	fileExtensions []string,
+	defaultExtension string,
+	titleTemplate string,
+	titleSubstitutions []string,
+) (*Resolver, error) {
+	regex, err := regexp.Compile(selectRegex)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return &Resolver{
+		root:               root,
+		selectRegex:        regex,
+		fileExtenstions:    fileExtensions,
+		defaultExtension:   defaultExtension,
+		titleTemplate:      titleTemplate,
+		titleSubstitutions: titleSubstitutions,
+	}, nil
 }
 
-func Title(path string, metadata map[string]string) string {
+// WithVaults returns a copy of the resolver for the vault with the given
+// name, which resolves notes of other vaults through vaults.
+func (r *Resolver) WithVaults(name string, vaults Vaults) *Resolver {
+	c := *r
+	c.name = name
+	c.vaults = vaults
+	return &c
+}
+
+// WithIgnore returns a copy of the resolver that treats the paths m ignores
+// as if they did not exist: they are neither scanned nor resolved.
+func (r *Resolver) WithIgnore(m *ignore.Matcher) *Resolver {
+	c := *r
+	c.ignore = m
+	return &c
+}
+
+// Root returns the directory the notes live in.
+func (r *Resolver) Root() string {
+	return r.root
+}
+
+// Name returns the name of the vault, if any.
+func (r *Resolver) Name() string {
+	return r.name
+}
+
+func (r *Resolver) Title(path string, metadata map[string]string) string {
 	if len(metadata) == 0 {
 		return path
 	}
 	var args []any
 
-	for _, s := range titleSubstitutions {
+	for _, s := range r.titleSubstitutions {
 		v, ok := metadata[string(s)]
 		if ok {
 			args = append(args, v)
@@ -72,30 +129,34 @@ func Title(path string, metadata map[string]string) string {
 		}
 	}
 
-	title := fmt.Sprintf(titleTemplate, args...)
+	title := fmt.Sprintf(r.titleTemplate, args...)
 	title = strings.TrimSpace(title)
 	return title
 }
 
-func Resolve(base any) (Note, error) {
+func (r *Resolver) Resolve(base any) (Note, error) {
 	switch v := base.(type) {
 	case string:
+		if name, rest, ok := r.splitVault(v); ok {
+			root, _ := r.vaults.Root(name)
+			return r.resolveAbsolute(filepath.Join(root, rest))
+		}
 		url, err := url.Parse(v)
 		if err != nil {
 			return Note{}, err
 		}
 		path := url.Path
 		if filepath.IsAbs(path) {
-			return resolveAbsolute(path)
+			return r.resolveAbsolute(path)
 		}
-		return resolveAbsolute(filepath.Join(root, v))
+		return r.resolveAbsolute(filepath.Join(r.root, v))
 	default:
 		return Note{}, fmt.Errorf("Invalid base type.")
 	}
 }
 
-func IngoreDir(absolutepath string) bool {
-	rel, err := filepath.Rel(root, absolutepath)
+func (r *Resolver) IngoreDir(absolutepath string) bool {
+	rel, err := filepath.Rel(r.root, absolutepath)
 	if err != nil {
 		return true
 	}
@@ -103,10 +164,10 @@ func IngoreDir(absolutepath string) bool {
 	if clean == "." {
 		return false
 	}
-	return strings.HasPrefix(clean, ".")
+	return strings.HasPrefix(clean, ".") || r.ignore.Ignored(filepath.ToSlash(clean), true)
 }
 
-func resolveAbsolute(absolutepath string) (Note, error) {
+func (r *Resolver) resolveAbsolute(absolutepath string) (Note, error) {
 	cleaned := filepath.Clean(absolutepath)
 	u := url.URL{
 		Scheme: "file",
@@ -114,74 +175,143 @@ func resolveAbsolute(absolutepath string) (Note, error) {
 	}
 	uri := protocol.DocumentUri(u.String())
 
-	rel, err := filepath.Rel(root, cleaned)
+	rel, err := filepath.Rel(r.root, cleaned)
 	if err != nil {
 		log.Printf("resolveAbsolute errored with %v", err)
 		return Note{}, err
 	}
+	vault := r.name
+	cachePath := cache.Path(rel)
+	// The note belongs to the vault with the innermost root containing it,
+	// which may be nested in this one.
+	if r.vaults != nil {
+		if name, root, ok := r.vaults.Vault(cleaned); ok && name != r.name {
+			if rel, err = filepath.Rel(root, cleaned); err != nil {
+				return Note{}, err
+			}
+			vault = name
+			cachePath = Qualify(name, rel)
+		}
+	}
 
 	found := false
 	ext := filepath.Ext(cleaned)
-	for _, e := range fileExtenstions {
+	for _, e := range r.fileExtenstions {
 		if e == ext {
 			found = true
 		}
 	}
 
 	if !found {
-		return Note{}, fmt.Errorf("No valid file extension.")
+		return Note{}, ErrInvalidExtension
+	}
+	if vault == r.name && filepath.IsLocal(rel) && r.ignore.Ignored(filepath.ToSlash(rel), false) {
+		return Note{}, ErrIgnored
 	}
-
-	cachePath := cache.Path(rel)
 
 	return Note{
 		URI:          uri,
 		AbsolutePath: cleaned,
 		RelativePath: rel,
 		CachePath:    cachePath,
+		Vault:        vault,
 	}, nil
 }
 
-func ResolveReference(source Note, reference string) (Note, error) {
+func (r *Resolver) ResolveReference(source Note, reference string) (Note, error) {
 	if len(reference) == 0 {
-		return Note{}, fmt.Errorf("Invalid path.")
+		return Note{}, ErrEmptyReference
 	}
 
-	matches := selectRegex.FindSubmatch([]byte(reference))
+	matches := r.selectRegex.FindSubmatch([]byte(reference))
 	if len(matches) < 2 {
-		return Note{}, fmt.Errorf("Invalid reference")
+		return Note{}, ErrInvalidReference
 	}
 	match := matches[1]
 	if match == nil {
-		return Note{}, fmt.Errorf("Invalid reference")
+		return Note{}, ErrInvalidReference
 	}
 
 	reference = string(match)
 
 	if reference == "" {
-		return Note{}, fmt.Errorf("Empty reference.")
+		return Note{}, ErrEmptyReference
 	}
 
 	if strings.HasSuffix(reference, "/") {
-		return Note{}, fmt.Errorf("Cannot reference directories.")
+		return Note{}, ErrDirectoryReference
 	}
 
 	// Add default extension if none is specified.
 	if filepath.Ext(reference) == "" {
-		reference += defaultExtension
+		reference += r.defaultExtension
 	}
 
 	// Check if path should be relative to note.
-	if reference[0] == []byte(`.`)[0] {
+	if IsRelativeReference(reference) {
 		base := filepath.Dir(source.AbsolutePath)
 		joined := filepath.Join(base, reference)
-		return Resolve(joined)
+		return r.Resolve(joined)
+	}
+
+	return r.Resolve(reference)
+}
+
+// splitVault splits a reference of the form vault:path to a known vault.
+func (r *Resolver) splitVault(reference string) (string, string, bool) {
+	if r.vaults == nil {
+		return "", "", false
+	}
+	name, rest, ok := strings.Cut(reference, VaultSeparator)
+	if !ok || strings.HasPrefix(rest, "//") {
+		return "", "", false // not a vault, but a URI
+	}
+	if _, ok := r.vaults.Root(name); !ok {
+		return "", "", false
 	}
+	return name, rest, true
+}
+
+// SelectIndex returns the byte offsets of the part of a raw reference that
+// select_regex extracts as its target.
+func (r *Resolver) SelectIndex(reference string) (int, int, bool) {
+	loc := r.selectRegex.FindStringSubmatchIndex(reference)
+	if len(loc) < 4 || loc[2] < 0 {
+		return 0, 0, false
+	}
+	return loc[2], loc[3], true
+}
+
+// IsRelativeReference reports whether a selected reference is resolved
+// relative to its source note rather than to the root.
+func IsRelativeReference(reference string) bool {
+	return strings.HasPrefix(reference, ".")
+}
 
-	return Resolve(reference)
+// Reference builds the (unwrapped) reference from source to target, either
+// relative to the source note or to the root. Notes in other vaults are
+// always referenced from the root of their vault.
+func (r *Resolver) Reference(source Note, target Note, relative bool, withExtension bool) string {
+	reference := target.RelativePath
+	if relative && target.Vault == source.Vault {
+		rel, err := filepath.Rel(filepath.Dir(source.AbsolutePath), target.AbsolutePath)
+		if err == nil {
+			reference = rel
+			if !IsRelativeReference(reference) {
+				reference = "./" + reference
+			}
+		}
+	}
+	if !withExtension && filepath.Ext(reference) == r.defaultExtension {
+		reference = strings.TrimSuffix(reference, r.defaultExtension)
+	}
+	if target.Vault != source.Vault {
+		reference = Qualify(target.Vault, reference)
+	}
+	return filepath.ToSlash(reference)
 }
 
-func ExtractLinksAndMeta(
+func (r *Resolver) ExtractLinksAndMeta(
 	note Note,
 	namedNodes map[string][]*sitter.Node,
 	document []byte,
@@ -194,14 +324,14 @@ func ExtractLinksAndMeta(
 	for _, n := range nodes {
 		reference := (*n).Content(document)
 
-		target, err := ResolveReference(note, reference)
+		target, err := r.ResolveReference(note, reference)
 		if err != nil {
 			continue
 		}
 
 		tgtPath := target.CachePath
 		// Compute the range for this reference
-		r := protocol.Range{
+		rng := protocol.Range{
 			Start: sitteradapter.TSPointToLSPPosition((*n).StartPoint(), string(document)),
 			End:   sitteradapter.TSPointToLSPPosition((*n).EndPoint(), string(document)),
 		}
@@ -210,7 +340,7 @@ func ExtractLinksAndMeta(
 		if _, exists := rangesMap[tgtPath]; !exists {
 			order = append(order, tgtPath)
 		}
-		rangesMap[tgtPath] = append(rangesMap[tgtPath], r)
+		rangesMap[tgtPath] = append(rangesMap[tgtPath], rng)
 	}
 
 	// Build slice of links grouped by target
@@ -0,0 +1,148 @@
+package resolver_test
+
+import (
+	"strings"
+	"testing"
+	"zeta/internal/ignore"
+	"zeta/internal/resolver"
+)
+
+func TestResolveReference(t *testing.T) {
+	t.Parallel()
+	r, err := resolver.New("/notes", `^"(.*)"$`, []string{".typ"}, ".typ", "%s", []string{"title"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := r.Resolve("/notes/a/source.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		reference string
+		want      string
+		err       error
+	}{
+		{`"b"`, "b.typ", nil},
+		{`"./b.typ"`, "a/b.typ", nil},
+		{`"../c"`, "c.typ", nil},
+		{`b`, "", resolver.ErrInvalidReference},
+		{`""`, "", resolver.ErrEmptyReference},
+		{`"dir/"`, "", resolver.ErrDirectoryReference},
+		{`"b.md"`, "", resolver.ErrInvalidExtension},
+	}
+	for _, test := range tests {
+		target, err := r.ResolveReference(source, test.reference)
+		if err != test.err {
+			t.Errorf("ResolveReference(%s): got error %v, want %v", test.reference, err, test.err)
+			continue
+		}
+		if target.CachePath != test.want {
+			t.Errorf("ResolveReference(%s) = %q, want %q", test.reference, target.CachePath, test.want)
+		}
+	}
+}
+
+func TestIndependentResolvers(t *testing.T) {
+	t.Parallel()
+	typst, err := resolver.New("/typst", `^"(.*)"$`, []string{".typ"}, ".typ", "%s", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown, err := resolver.New("/markdown", `^\[\[(.*)\]\]$`, []string{".md"}, ".md", "%s", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := typst.Resolve("/markdown/note.md"); err == nil {
+		t.Error("typst resolver accepted a markdown note")
+	}
+	note, err := markdown.Resolve("/markdown/note.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := markdown.ResolveReference(note, "[[other]]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.AbsolutePath != "/markdown/other.md" {
+		t.Errorf("got %q, want /markdown/other.md", target.AbsolutePath)
+	}
+}
+
+// vaults is a fixed set of vault roots.
+type vaults map[string]string
+
+func (vs vaults) Root(name string) (string, bool) {
+	root, ok := vs[name]
+	return root, ok
+}
+
+func (vs vaults) Vault(absolutepath string) (string, string, bool) {
+	var name, root string
+	for n, r := range vs {
+		if strings.HasPrefix(absolutepath, r+"/") && len(r) > len(root) {
+			name, root = n, r
+		}
+	}
+	return name, root, root != ""
+}
+
+func TestCrossVaultReferences(t *testing.T) {
+	t.Parallel()
+	vs := vaults{"work": "/work", "home": "/home"}
+	r, err := resolver.New("/work", `^"(.*)"$`, []string{".typ"}, ".typ", "%s", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	work := r.WithVaults("work", vs)
+	source, err := work.Resolve("/work/a/source.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := work.ResolveReference(source, `"home:b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.AbsolutePath != "/home/b.typ" || target.Vault != "home" {
+		t.Errorf("got %q in vault %q, want /home/b.typ in vault home", target.AbsolutePath, target.Vault)
+	}
+	if target.RelativePath != "b.typ" || target.CachePath != "home:b.typ" {
+		t.Errorf("got relative path %q and cache path %q", target.RelativePath, target.CachePath)
+	}
+	if got := work.Reference(source, target, true, false); got != "home:b" {
+		t.Errorf("Reference = %q, want home:b", got)
+	}
+	// Unknown vaults are not vaults, but part of the path.
+	local, err := work.ResolveReference(source, `"other:b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.Vault != "work" || local.CachePath != "other:b.typ" {
+		t.Errorf("got %q in vault %q, want other:b.typ in vault work", local.CachePath, local.Vault)
+	}
+}
+
+func TestIgnoredPaths(t *testing.T) {
+	t.Parallel()
+	r, err := resolver.New("/notes", `^"(.*)"$`, []string{".typ"}, ".typ", "%s", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = r.WithIgnore(ignore.New([]string{"build/", "/drafts"}))
+
+	if !r.IngoreDir("/notes/build") {
+		t.Error("build directory is not ignored")
+	}
+	if _, err := r.Resolve("/notes/build/out.typ"); err != resolver.ErrIgnored {
+		t.Errorf("Resolve(build/out.typ): got error %v, want %v", err, resolver.ErrIgnored)
+	}
+	source, err := r.Resolve("/notes/source.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ResolveReference(source, `"drafts/idea"`); err != resolver.ErrIgnored {
+		t.Errorf("ResolveReference(drafts/idea): got error %v, want %v", err, resolver.ErrIgnored)
+	}
+}
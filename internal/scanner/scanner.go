@@ -10,42 +10,71 @@ import (
 	"zeta/internal/resolver"
 )
 
-// Scan walks the entire subtree under root. Any file or directory
-// whose name begins with “.” is skipped entirely. For each remaining
-// file, we apply your skip() predicate, and if that returns false
-// we read the file and invoke callback(relPath, contents).
-// Scan will only return once all callbacks have completed.
-func Scan(
-	root string,
-	skip func(relPath string, info fs.FileInfo) bool,
-	callback func(relPath string, document []byte),
+// Scan walks the entire subtree under the root of r. Any file or directory
+// whose name begins with “.” is skipped entirely, as is every file that does
+// not resolve to a note. For each remaining note, we apply your skip()
+// predicate, and if that returns false we read the file and invoke
+// parse(note, info, contents) on one of the workers, concurrently. Every
+// successful result is handed to commit, one at a time; parse reports its
+// own errors.
+// Scan will only return once all commits have completed.
+func Scan[T any](
+	r *resolver.Resolver,
+	workers int,
+	skip func(note resolver.Note, info fs.FileInfo) bool,
+	parse func(note resolver.Note, info fs.FileInfo, document []byte) (T, error),
+	commit func(note resolver.Note, result T),
 ) {
-	fileCh := make(chan string, 100)
+	type file struct {
+		note resolver.Note
+		info fs.FileInfo
+	}
+	type parsed struct {
+		note   resolver.Note
+		result T
+	}
+	fileCh := make(chan file, 100)
+	parsedCh := make(chan parsed, 100)
 	var wg sync.WaitGroup
 
-	// worker goroutine
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for path := range fileCh {
-			data, err := os.ReadFile(path)
-			if err != nil {
-				log.Println("scanner: read error:", path, err)
-				continue
+	// worker goroutines
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range fileCh {
+				data, err := os.ReadFile(f.note.AbsolutePath)
+				if err != nil {
+					log.Println("scanner: read error:", f.note.AbsolutePath, err)
+					continue
+				}
+				result, err := parse(f.note, f.info, data)
+				if err != nil {
+					continue
+				}
+				parsedCh <- parsed{f.note, result}
 			}
-			callback(path, data)
+		}()
+	}
+
+	// the committer goroutine serialises the commits
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		for p := range parsedCh {
+			commit(p.note, p.result)
 		}
 	}()
 
-	log.Printf("scanner: starting WalkDir at %q", root)
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+	log.Printf("scanner: starting WalkDir at %q", r.Root())
+	err := filepath.WalkDir(r.Root(), func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			log.Println("scanner: walk error:", err)
 			return nil
 		}
 
 		if d.IsDir() {
-			if resolver.IngoreDir(path) {
+			if r.IngoreDir(path) {
 				log.Printf("Skipping %q", path)
 				return fs.SkipDir
 			}
@@ -53,16 +82,20 @@ func Scan(
 			return nil
 		}
 
+		note, err := r.Resolve(path)
+		if err != nil {
+			return nil
+		}
 		info, err := d.Info()
 		if err != nil {
 			return nil
 		}
-		if skip(path, info) {
+		if skip(note, info) {
 			return nil
 		}
 
 		// enqueue for reading
-		fileCh <- path
+		fileCh <- file{note, info}
 		return nil
 	})
 	if err != nil {
@@ -71,6 +104,8 @@ func Scan(
 
 	// no more files to send
 	close(fileCh)
-	// wait for the worker to finish consuming and calling back
+	// wait for the workers to finish parsing, then for the last commits
 	wg.Wait()
+	close(parsedCh)
+	<-committed
 }
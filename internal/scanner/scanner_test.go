@@ -0,0 +1,109 @@
+package scanner_test
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"zeta/internal/config"
+	"zeta/internal/parser"
+	"zeta/internal/resolver"
+	"zeta/internal/scanner"
+)
+
+// generateVault writes n notes, each linking to a few others, spread over
+// directories of 1000 notes.
+func generateVault(tb testing.TB, n int) string {
+	tb.Helper()
+	root := tb.TempDir()
+	for i := range n {
+		dir := filepath.Join(root, fmt.Sprintf("d%03d", i/1000))
+		if i%1000 == 0 {
+			if err := os.Mkdir(dir, 0o755); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		note := fmt.Sprintf(
+			"= Note %d\n\nSee #link(\"d%03d/n%d\") and #link(\"d%03d/n%d\").\n\n%s\n",
+			i, (i+1)%n/1000, (i+1)%n, (i*7)%n/1000, (i*7)%n,
+			"Lorem ipsum dolor sit amet, consectetur adipiscing elit. ",
+		)
+		path := filepath.Join(dir, fmt.Sprintf("n%d.typ", i))
+		if err := os.WriteFile(path, []byte(note), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return root
+}
+
+func newResolver(tb testing.TB, root string) *resolver.Resolver {
+	tb.Helper()
+	r, err := resolver.New(root, `^"(.*)"$`, []string{".typ"}, ".typ", "%s", nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return r
+}
+
+func noSkip(resolver.Note, fs.FileInfo) bool { return false }
+
+func TestScanCommitsSerially(t *testing.T) {
+	t.Parallel()
+	const notes = 500
+	r := newResolver(t, generateVault(t, notes))
+
+	var parsed, committing atomic.Int64
+	committed := map[string]bool{}
+	parse := func(note resolver.Note, info fs.FileInfo, document []byte) (int, error) {
+		parsed.Add(1)
+		return len(document), nil
+	}
+	commit := func(note resolver.Note, size int) {
+		if committing.Add(1) != 1 {
+			t.Error("concurrent commits")
+		}
+		committed[note.CachePath] = true
+		committing.Add(-1)
+	}
+	scanner.Scan(r, 8, noSkip, parse, commit)
+
+	if parsed.Load() != notes || len(committed) != notes {
+		t.Errorf("parsed %d and committed %d notes, want %d", parsed.Load(), len(committed), notes)
+	}
+}
+
+// BenchmarkScan scans a generated vault of 50k notes with the default query
+// and different numbers of workers.
+func BenchmarkScan(b *testing.B) {
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	r := newResolver(b, generateVault(b, 50_000))
+	cfg, err := config.Load(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	query := []byte(cfg.Query)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			parsers := parser.NewParserPool(workers)
+			parse := func(note resolver.Note, info fs.FileInfo, document []byte) (int, error) {
+				nodes, err := parsers.ParseAndQuery(document, query)
+				if err != nil {
+					return 0, err
+				}
+				links, _ := r.ExtractLinksAndMeta(note, nodes, document)
+				return len(links), nil
+			}
+			for range b.N {
+				var links int
+				commit := func(note resolver.Note, n int) { links += n }
+				scanner.Scan(r, workers, noSkip, parse, commit)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Package search is a full-text index of notes, ranked with BM25.
+package search
+
+import (
+	"bytes"
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters: k1 dampens repeated terms, b normalises by note length.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Document is the analysed content of a note: how often each term occurs.
+type Document struct {
+	terms  map[string]int
+	length int
+}
+
+// Analyze tokenises the content of a note. It is safe to call concurrently,
+// so the scan workers analyse notes before they are added.
+func Analyze(content []byte) Document {
+	doc := Document{terms: map[string]int{}}
+	for _, term := range Tokenize(string(content)) {
+		doc.terms[term]++
+		doc.length++
+	}
+	return doc
+}
+
+// Tokenize splits text into lower-case words of letters and digits.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Hit is a note matching a query.
+type Hit struct {
+	Path  string
+	Score float64
+}
+
+// Index maps terms to the notes they occur in. It is safe for concurrent
+// use.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[string]int // term -> path -> occurrences
+	docs     map[string]Document
+	length   int // of all documents together
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[string]int{},
+		docs:     map[string]Document{},
+	}
+}
+
+// Put adds a note to the index, replacing an earlier version.
+func (ix *Index) Put(path string, doc Document) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.put(path, doc)
+}
+
+// Delete removes a note from the index.
+func (ix *Index) Delete(path string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(path)
+}
+
+// Rename moves a note in the index to a new path.
+func (ix *Index) Rename(oldPath, newPath string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	doc, ok := ix.docs[oldPath]
+	if !ok {
+		return
+	}
+	ix.remove(oldPath)
+	ix.put(newPath, doc)
+}
+
+// Has reports whether a note is in the index.
+func (ix *Index) Has(path string) bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	_, ok := ix.docs[path]
+	return ok
+}
+
+// put adds or replaces a note. The caller holds ix.mu.
+func (ix *Index) put(path string, doc Document) {
+	ix.remove(path)
+	for term, n := range doc.terms {
+		if ix.postings[term] == nil {
+			ix.postings[term] = map[string]int{}
+		}
+		ix.postings[term][path] = n
+	}
+	ix.docs[path] = doc
+	ix.length += doc.length
+}
+
+// remove deletes a note. The caller holds ix.mu.
+func (ix *Index) remove(path string) {
+	doc, ok := ix.docs[path]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(ix.postings[term], path)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.docs, path)
+	ix.length -= doc.length
+}
+
+// Search returns the notes matching any term of the query, best first, at
+// most limit of them.
+func (ix *Index) Search(query string, limit int) []Hit {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	hits := []Hit{} // empty, not nil
+	if len(ix.docs) == 0 || limit <= 0 {
+		return hits
+	}
+	n := float64(len(ix.docs))
+	avgLength := float64(ix.length) / n
+	scores := map[string]float64{}
+	terms := Tokenize(query)
+	slices.Sort(terms)
+	for _, term := range slices.Compact(terms) {
+		postings := ix.postings[term]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for path, occurrences := range postings {
+			tf := float64(occurrences)
+			norm := 1 - b + b*float64(ix.docs[path].length)/avgLength
+			scores[path] += idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+	}
+
+	for path, score := range scores {
+		hits = append(hits, Hit{Path: path, Score: score})
+	}
+	slices.SortFunc(hits, func(x, y Hit) int {
+		return cmp.Or(cmp.Compare(y.Score, x.Score), cmp.Compare(x.Path, y.Path))
+	})
+	return hits[:min(limit, len(hits))]
+}
+
+// Snippet is a run of lines of a note that match a query. Lines are
+// zero-based, as in LSP ranges.
+type Snippet struct {
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Text      string `json:"text"`
+}
+
+// maxSnippetLength is the number of bytes of a line shown in a snippet.
+const maxSnippetLength = 200
+
+// Snippets returns up to limit runs of consecutive lines of content that
+// contain a term of the query.
+func Snippets(content []byte, query string, limit int) []Snippet {
+	terms := map[string]bool{}
+	for _, term := range Tokenize(query) {
+		terms[term] = true
+	}
+
+	snippets := []Snippet{} // empty, not nil
+	if limit <= 0 {
+		return snippets
+	}
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		if !slices.ContainsFunc(Tokenize(string(line)), func(t string) bool { return terms[t] }) {
+			continue
+		}
+		text := strings.TrimSpace(string(line))
+		if len(text) > maxSnippetLength {
+			text = strings.ToValidUTF8(text[:maxSnippetLength], "") + "…"
+		}
+		if last := len(snippets) - 1; last >= 0 && snippets[last].EndLine == i-1 {
+			snippets[last].EndLine = i
+			snippets[last].Text += "\n" + text
+			continue
+		}
+		if len(snippets) == limit {
+			break
+		}
+		snippets = append(snippets, Snippet{StartLine: i, EndLine: i, Text: text})
+	}
+	return snippets
+}
@@ -0,0 +1,51 @@
+package search_test
+
+import (
+	"testing"
+	"zeta/internal/search"
+)
+
+func TestSearchRanking(t *testing.T) {
+	ix := search.NewIndex()
+	ix.Put("zettel.typ", search.Analyze([]byte("= Zettelkasten\nA zettelkasten links notes.\nNotes, notes, notes.")))
+	ix.Put("typst.typ", search.Analyze([]byte("= Typst\nTypst is a markup language for notes.")))
+	ix.Put("other.typ", search.Analyze([]byte("= Other\nNothing to see here.")))
+
+	hits := ix.Search("Notes", 10)
+	if len(hits) != 2 || hits[0].Path != "zettel.typ" {
+		t.Fatalf("hits for notes: %+v", hits)
+	}
+	if hits := ix.Search("notes", -1); len(hits) != 0 {
+		t.Errorf("hits without a limit: %+v", hits)
+	}
+	// Rare terms weigh more than common ones.
+	if hits := ix.Search("markup notes", 10); hits[0].Path != "typst.typ" {
+		t.Errorf("hits for markup notes: %+v", hits)
+	}
+
+	ix.Rename("typst.typ", "typst/intro.typ")
+	if hits := ix.Search("markup", 10); len(hits) != 1 || hits[0].Path != "typst/intro.typ" {
+		t.Errorf("hits after rename: %+v", hits)
+	}
+	ix.Delete("zettel.typ")
+	if hits := ix.Search("zettelkasten", 10); len(hits) != 0 {
+		t.Errorf("hits after delete: %+v", hits)
+	}
+}
+
+func TestSnippets(t *testing.T) {
+	content := []byte("= Title\nfirst match\nsecond Match\n\nno luck\nthird match")
+	snippets := search.Snippets(content, "match", 10)
+	want := []search.Snippet{
+		{StartLine: 1, EndLine: 2, Text: "first match\nsecond Match"},
+		{StartLine: 5, EndLine: 5, Text: "third match"},
+	}
+	if len(snippets) != len(want) {
+		t.Fatalf("snippets: %+v", snippets)
+	}
+	for i := range want {
+		if snippets[i] != want[i] {
+			t.Errorf("snippet %d: %+v, want %+v", i, snippets[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"zeta/internal/resolver"
+	"zeta/internal/sitteradapter"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func (s *Server) textDocumentPrepareCallHierarchy(
+	context *glsp.Context,
+	params *protocol.CallHierarchyPrepareParams,
+) ([]protocol.CallHierarchyItem, error) {
+	// Start from the link under the cursor, or else from the note itself.
+	subject, _, err := s.noteAt(params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, err
+	}
+	return []protocol.CallHierarchyItem{s.callHierarchyItem(subject)}, nil
+}
+
+func (s *Server) callHierarchyIncomingCalls(
+	context *glsp.Context,
+	params *protocol.CallHierarchyIncomingCallsParams,
+) ([]protocol.CallHierarchyIncomingCall, error) {
+	_, note, err := s.vaultOf(params.Item.URI)
+	if err != nil {
+		return nil, err
+	}
+	backlinks, err := s.incomingLinks(note)
+	if err != nil {
+		return nil, err
+	}
+
+	calls := []protocol.CallHierarchyIncomingCall{} // empty, not nil
+	for _, l := range backlinks {
+		source, err := l.vault.resolver.Resolve(l.Source)
+		if err != nil {
+			continue
+		}
+		calls = append(calls, protocol.CallHierarchyIncomingCall{
+			From:       s.callHierarchyItem(source),
+			FromRanges: l.Ranges,
+		})
+	}
+	return calls, nil
+}
+
+func (s *Server) callHierarchyOutgoingCalls(
+	context *glsp.Context,
+	params *protocol.CallHierarchyOutgoingCallsParams,
+) ([]protocol.CallHierarchyOutgoingCall, error) {
+	v, note, err := s.vaultOf(params.Item.URI)
+	if err != nil {
+		return nil, err
+	}
+	forward, err := v.cache.GetForwardLinks(note.CachePath)
+	if err != nil {
+		return nil, err
+	}
+
+	calls := []protocol.CallHierarchyOutgoingCall{} // empty, not nil
+	for _, l := range forward {
+		target, err := v.resolver.Resolve(l.Target)
+		if err != nil {
+			continue
+		}
+		calls = append(calls, protocol.CallHierarchyOutgoingCall{
+			To:         s.callHierarchyItem(target),
+			FromRanges: l.Ranges,
+		})
+	}
+	return calls, nil
+}
+
+// callHierarchyItem represents a note in the call hierarchy. It spans the
+// note, so that it contains the ranges of the links from it, and is selected
+// at the start of the note.
+func (s *Server) callHierarchyItem(note resolver.Note) protocol.CallHierarchyItem {
+	detail := note.RelativePath
+	if !s.noteExists(note) {
+		detail += " (not yet created)"
+	}
+	start := protocol.Position{Line: 0, Character: 0}
+	return protocol.CallHierarchyItem{
+		Name:           s.title(note),
+		Kind:           protocol.SymbolKindFile,
+		Detail:         &detail,
+		URI:            note.URI,
+		Range:          s.noteRange(note),
+		SelectionRange: protocol.Range{Start: start, End: start},
+	}
+}
+
+// noteRange returns a range from the start of a note that contains the links
+// from it: the whole document if it is open, or else up to the end of its
+// last link in the cache, so that closed notes are not read.
+func (s *Server) noteRange(note resolver.Note) protocol.Range {
+	start := protocol.Position{Line: 0, Character: 0}
+	whole := protocol.Range{Start: start, End: start}
+	o := s.owner(note)
+	if o == nil {
+		return whole
+	}
+	if doc, err := o.manager.GetDocument(note.URI); err == nil {
+		whole.End = sitteradapter.OffsetToLSPPosition(len(doc), string(doc))
+		return whole
+	}
+	links, _ := o.cache.GetForwardLinks(note.RelativePath)
+	for _, l := range links {
+		for _, r := range l.Ranges {
+			if !inRange(r.End, whole) {
+				whole.End = r.End
+			}
+		}
+	}
+	return whole
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"os"
+	"testing"
+	"zeta/internal/cache"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestCallHierarchyItemRange(t *testing.T) {
+	s, v := newTestServer(t,
+		map[string]string{
+			"a.typ": "= A\n\n#link(\"b\")\n\nand #link(\"c\") here\n",
+			"b.typ": "= B\n",
+			"c.typ": "= C\n",
+		},
+		map[string][]cache.Link{
+			"a.typ": {
+				{Source: "a.typ", Target: "b.typ", Ranges: []protocol.Range{{
+					Start: protocol.Position{Line: 2, Character: 6},
+					End:   protocol.Position{Line: 2, Character: 9},
+				}}},
+				{Source: "a.typ", Target: "c.typ", Ranges: []protocol.Range{{
+					Start: protocol.Position{Line: 4, Character: 10},
+					End:   protocol.Position{Line: 4, Character: 13},
+				}}},
+			},
+		},
+	)
+	a, err := v.resolver.Resolve("a.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A closed note spans its links, without being read.
+	if err := os.Remove(a.AbsolutePath); err != nil {
+		t.Fatal(err)
+	}
+	want := protocol.Position{Line: 4, Character: 13}
+	if got := s.callHierarchyItem(a).Range.End; got != want {
+		t.Errorf("closed note ends at %v, want %v", got, want)
+	}
+
+	// An open note spans the whole document.
+	v.manager.UpdateDocument(a.URI, []byte("= A\n\n#link(\"b\")\n\nand #link(\"c\") here\nmore\n"))
+	want = protocol.Position{Line: 6, Character: 0}
+	if got := s.callHierarchyItem(a).Range.End; got != want {
+		t.Errorf("open note ends at %v, want %v", got, want)
+	}
+}
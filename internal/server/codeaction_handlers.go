@@ -0,0 +1,157 @@
+package server
+
+import (
+	"path/filepath"
+	"strings"
+	"text/template"
+	"zeta/internal/resolver"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// CodeActionKindCreateMissingNotes creates every missing note linked from a document.
+const CodeActionKindCreateMissingNotes = protocol.CodeActionKind("source.createMissingNotes")
+
+// noteTemplateData is substituted into the note_template of new notes.
+type noteTemplateData struct {
+	Title       string // derived from the file name
+	Path        string // relative to the root
+	Source      string // path of the note that links to the new note
+	SourceTitle string
+}
+
+func (s *Server) textDocumentCodeAction(
+	context *glsp.Context,
+	params *protocol.CodeActionParams,
+) (any, error) {
+	v, source, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []protocol.CodeAction{}
+	// All actions create files.
+	if !s.supportsResourceOperation(protocol.ResourceOperationKindCreate) {
+		return actions, nil
+	}
+	if wantsCodeAction(params.Context.Only, protocol.CodeActionKindQuickFix) {
+		for _, d := range params.Context.Diagnostics {
+			path, ok := d.Data.(string)
+			if !ok {
+				continue
+			}
+			target, err := v.resolver.Resolve(path)
+			if err != nil || s.noteExists(target) {
+				continue
+			}
+			changes, err := s.createNoteChanges(source, target)
+			if err != nil {
+				return nil, err
+			}
+			kind := protocol.CodeActionKindQuickFix
+			actions = append(actions, protocol.CodeAction{
+				Title:       "Create note " + target.RelativePath,
+				Kind:        &kind,
+				Diagnostics: []protocol.Diagnostic{d},
+				IsPreferred: &protocol.True,
+				Edit:        &protocol.WorkspaceEdit{DocumentChanges: changes},
+				Command: &protocol.Command{
+					Title:     "Open " + target.RelativePath,
+					Command:   "open",
+					Arguments: []any{target.URI},
+				},
+			})
+		}
+	}
+
+	if wantsCodeAction(params.Context.Only, CodeActionKindCreateMissingNotes) {
+		links, err := v.cache.GetForwardLinks(source.CachePath)
+		if err != nil {
+			return nil, err
+		}
+		changes := []any{}
+		for _, l := range links {
+			target, err := v.resolver.Resolve(l.Target)
+			if err != nil || s.noteExists(target) {
+				continue
+			}
+			c, err := s.createNoteChanges(source, target)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, c...)
+		}
+		if len(changes) > 0 {
+			kind := CodeActionKindCreateMissingNotes
+			actions = append(actions, protocol.CodeAction{
+				Title: "Create all missing notes in this file",
+				Kind:  &kind,
+				Edit:  &protocol.WorkspaceEdit{DocumentChanges: changes},
+			})
+		}
+	}
+	return actions, nil
+}
+
+// wantsCodeAction reports whether the client asked for code actions of the kind.
+func wantsCodeAction(only []protocol.CodeActionKind, kind protocol.CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, o := range only {
+		if o == kind || strings.HasPrefix(string(kind), string(o)+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// createNoteChanges returns the document changes that create target, filled
+// from the note template.
+func (s *Server) createNoteChanges(source resolver.Note, target resolver.Note) ([]any, error) {
+	changes := []any{
+		protocol.CreateFile{
+			Kind:    "create",
+			URI:     target.URI,
+			Options: &protocol.CreateFileOptions{IgnoreIfExists: &protocol.True},
+		},
+	}
+	content, err := s.renderNoteTemplate(source, target)
+	if err != nil {
+		return nil, err
+	}
+	if content == "" {
+		return changes, nil
+	}
+	changes = append(changes, protocol.TextDocumentEdit{
+		TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: target.URI},
+		},
+		Edits: []any{protocol.TextEdit{NewText: content}},
+	})
+	return changes, nil
+}
+
+// renderNoteTemplate executes the configured note_template for a new note.
+func (s *Server) renderNoteTemplate(source resolver.Note, target resolver.Note) (string, error) {
+	if s.config.NoteTemplate == "" {
+		return "", nil
+	}
+	tmpl, err := template.New("note").Parse(s.config.NoteTemplate)
+	if err != nil {
+		return "", err
+	}
+	base := filepath.Base(target.RelativePath)
+	data := noteTemplateData{
+		Title:       strings.TrimSuffix(base, filepath.Ext(base)),
+		Path:        target.RelativePath,
+		Source:      source.RelativePath,
+		SourceTitle: s.title(source),
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
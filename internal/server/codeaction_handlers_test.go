@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"zeta/internal/cache"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestCreateNoteCodeAction(t *testing.T) {
+	links := []cache.Link{link("a.typ", "missing.typ", 6, 15)}
+	s, v := newTestServer(t,
+		map[string]string{"a.typ": `#link("missing")`},
+		map[string][]cache.Link{"a.typ": links},
+	)
+	s.config.NoteTemplate = "= {{.Title}}\n"
+	a, err := v.resolver.Resolve("a.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := v.resolver.Resolve("missing.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The diagnostics come back from the client as JSON.
+	var diagnostics []protocol.Diagnostic
+	data, err := json.Marshal(s.linkDiagnostics(v, links))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &diagnostics); err != nil {
+		t.Fatal(err)
+	}
+	params := &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: a.URI},
+		Context: protocol.CodeActionContext{
+			Diagnostics: diagnostics,
+			Only:        []protocol.CodeActionKind{protocol.CodeActionKindQuickFix},
+		},
+	}
+	codeActions := func() []protocol.CodeAction {
+		t.Helper()
+		result, err := s.textDocumentCodeAction(nil, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.([]protocol.CodeAction)
+	}
+
+	// Clients that cannot create files get no actions.
+	if actions := codeActions(); len(actions) != 0 {
+		t.Errorf("got %d code actions without the create operation: %+v", len(actions), actions)
+	}
+
+	s.capabilities = workspaceEditCapabilities(protocol.ResourceOperationKindCreate)
+	actions := codeActions()
+	if len(actions) != 1 {
+		t.Fatalf("got %d code actions, want 1: %+v", len(actions), actions)
+	}
+	action := actions[0]
+	if action.Title != "Create note missing.typ" {
+		t.Errorf("got title %q", action.Title)
+	}
+	if !reflect.DeepEqual(action.Diagnostics, diagnostics) {
+		t.Errorf("got diagnostics %+v, want %+v", action.Diagnostics, diagnostics)
+	}
+	want := []any{
+		protocol.CreateFile{
+			Kind:    "create",
+			URI:     missing.URI,
+			Options: &protocol.CreateFileOptions{IgnoreIfExists: &protocol.True},
+		},
+		protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: missing.URI},
+			},
+			Edits: []any{protocol.TextEdit{NewText: "= missing\n"}},
+		},
+	}
+	if action.Edit == nil || !reflect.DeepEqual(action.Edit.DocumentChanges, want) {
+		t.Errorf("got edit %+v, want document changes %+v", action.Edit, want)
+	}
+}
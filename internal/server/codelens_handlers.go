@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+	"zeta/internal/cache"
+	"zeta/internal/manager"
+	"zeta/internal/resolver"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// codeLensRefreshDelay bundles bursts of graph events into a single refresh.
+const codeLensRefreshDelay = 250 * time.Millisecond
+
+// showReferencesCommand is the client command the backlinks lens runs. It
+// takes the uri and position of the note and the locations to list, as in
+// VS Code. Other clients map it to their own list of locations.
+const showReferencesCommand = "editor.action.showReferences"
+
+func (s *Server) textDocumentCodeLens(
+	context *glsp.Context,
+	params *protocol.CodeLensParams,
+) ([]protocol.CodeLens, error) {
+	v, note, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	backlinks, err := s.incomingLinks(note)
+	if err != nil {
+		return nil, err
+	}
+	locations, err := s.backlinkLocations(note)
+	if err != nil {
+		return nil, err
+	}
+	forward, err := v.cache.GetForwardLinks(note.CachePath)
+	if err != nil {
+		return nil, err
+	}
+	dangling := 0
+	for _, l := range forward {
+		target, err := v.resolver.Resolve(l.Target)
+		if err != nil || !s.noteExists(target) {
+			dangling++
+		}
+	}
+
+	title := fmt.Sprintf("%d backlinks · %d outgoing", len(backlinks), len(forward))
+	if dangling > 0 {
+		title += fmt.Sprintf(" · %d dangling", dangling)
+	}
+	start := protocol.Position{}
+	return []protocol.CodeLens{
+		{
+			Range: protocol.Range{Start: start, End: start},
+			Command: &protocol.Command{
+				Title:     title,
+				Command:   showReferencesCommand,
+				Arguments: []any{note.URI, start, append([]protocol.Location{}, locations...)},
+			},
+		},
+	}, nil
+}
+
+// refreshCodeLenses asks the client to refresh its code lenses whenever an
+// event of a vault touches a document open in any of the managers.
+func (s *Server) refreshCodeLenses(
+	r *resolver.Resolver,
+	managers []*manager.DocumentManager,
+	events <-chan cache.Event,
+) {
+	var pending atomic.Bool
+	for ev := range events {
+		// Missed events may have touched any document.
+		touched := ev.Type == cache.Resync || touchesOpenDocument(r, managers, ev)
+		if !touched || pending.Swap(true) {
+			continue
+		}
+		time.AfterFunc(codeLensRefreshDelay, func() {
+			pending.Store(false)
+			s.client.Call(string(protocol.ServerWorkspaceCodeLensRefresh), nil, nil)
+		})
+	}
+}
+
+// touchesOpenDocument reports whether a note involved in the event is open.
+func touchesOpenDocument(r *resolver.Resolver, managers []*manager.DocumentManager, ev cache.Event) bool {
+	var paths []cache.Path
+	if ev.Note != nil {
+		paths = append(paths, ev.Note.Path, ev.Note.NewPath)
+	}
+	if ev.Link != nil {
+		paths = append(paths, ev.Link.Source, ev.Link.Target)
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		note, err := r.Resolve(path)
+		if err != nil {
+			continue
+		}
+		for _, m := range managers {
+			if m.IsOpen(note.URI) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,8 +1,9 @@
 package server
 
 import (
-	"context"
+	"fmt"
 	"log"
+	"sync"
 	"zeta/internal/cache"
 	"zeta/internal/graph"
 	"zeta/internal/resolver"
@@ -15,12 +16,85 @@ func (s *Server) workspaceExecuteCommand(
 	context *glsp.Context,
 	params *protocol.ExecuteCommandParams,
 ) (any, error) {
-	if params.Command == "graph" {
+	switch params.Command {
+	case "graph":
 		return nil, s.graph(context)
+	case "open":
+		return nil, s.open(context, params.Arguments)
+	case "backlinks":
+		return s.backlinks(params.Arguments)
+	case "neighbourhood":
+		return s.neighbourhood(params.Arguments)
+	case "path":
+		return s.shortestPath(params.Arguments)
+	case "components":
+		return s.components(params.Arguments)
+	case "strongly_connected":
+		return s.stronglyConnected(params.Arguments)
+	case "orphans":
+		return s.orphans(params.Arguments)
+	case "leaves":
+		return s.leaves(params.Arguments)
+	case "most_linked":
+		return s.mostLinked(params.Arguments)
 	}
 	return nil, nil
 }
 
+// backlinks returns the locations of all links to the note given as the
+// first argument.
+func (s *Server) backlinks(args []any) ([]protocol.Location, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("backlinks: missing document uri")
+	}
+	uri, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("backlinks: invalid document uri %v", args[0])
+	}
+	_, note, err := s.vaultOf(uri)
+	if err != nil {
+		return nil, err
+	}
+	return s.backlinkLocations(note)
+}
+
+// open shows the document given as the first argument in the editor.
+func (s *Server) open(ctx *glsp.Context, args []any) error {
+	if len(args) == 0 {
+		return fmt.Errorf("open: missing document uri")
+	}
+	uri, ok := args[0].(string)
+	if !ok {
+		return fmt.Errorf("open: invalid document uri %v", args[0])
+	}
+	s.showDocument(ctx, protocol.ShowDocumentParams{
+		URI:       protocol.URI(uri),
+		External:  &protocol.False,
+		TakeFocus: &protocol.True,
+	})
+	return nil
+}
+
+// showDocument asks the client to show a document, and tells the user if it
+// could not. The request must not block the handler, so it is sent from a
+// goroutine.
+func (s *Server) showDocument(ctx *glsp.Context, params protocol.ShowDocumentParams) {
+	go func() {
+		var result protocol.ShowDocumentResult
+		err := s.call(string(protocol.ServerWindowShowDocument), params, &result)
+		if err == nil && result.Success {
+			return
+		}
+		if err != nil {
+			log.Printf("Error showing %s: %v", params.URI, err)
+		}
+		ctx.Notify(string(protocol.ServerWindowShowMessage), protocol.ShowMessageParams{
+			Type:    protocol.MessageTypeWarning,
+			Message: "Could not open " + params.URI,
+		})
+	}()
+}
+
 func (s *Server) graph(ctx *glsp.Context) error {
 	log.Println("called 'graph'")
 	reuse := true
@@ -28,98 +102,195 @@ func (s *Server) graph(ctx *glsp.Context) error {
 		s.graphAddr = graph.ShowGraph(":0")
 		reuse = false
 	}
-	ctx.Notify(
-		"window/showDocument",
-		protocol.ShowDocumentParams{
-			URI:      protocol.URI(s.graphAddr),
-			External: &protocol.True,
-		},
-	)
+	s.showDocument(ctx, protocol.ShowDocumentParams{
+		URI:      protocol.URI(s.graphAddr),
+		External: &protocol.True,
+	})
 
 	if reuse {
 		return nil
 	}
+	return s.listenGraph()
+}
 
-	updates, err := s.cache.Subscribe(context.Background())
-	if err != nil {
+// listenGraph shows the caches of all vaults in the graph viewer, starting
+// from scratch.
+func (s *Server) listenGraph() error {
+	if err := graph.Reset(); err != nil {
 		return err
 	}
-
-	go ProcessEvents(s, updates)
+	view := &graphView{
+		ids:     map[cache.Path]int{},
+		sources: map[cache.Path]map[string]bool{},
+		links:   map[string]map[graph.Link]bool{},
+	}
+	for _, v := range s.vaults {
+		updates, err := v.cache.Subscribe(s.listeners, cache.SubscribeOptions{})
+		if err != nil {
+			return err
+		}
+		go view.ProcessEvents(v.name, v.resolver, updates)
+	}
 	return nil
 }
 
-func ProcessEvents(s *Server, events <-chan cache.Event) {
-	idCounter := 0
-	index := map[cache.Path]int{}
-	pathToId := func(path cache.Path) int {
-		if id, ok := index[path]; ok {
-			return id
-		}
-		idCounter++
-		index[path] = idCounter
-		return idCounter
+// graphView merges the events of all vaults into one graph. Nodes are keyed
+// by their qualified path, so a link to another vault ends at the node of
+// the note there rather than at a placeholder of its own.
+type graphView struct {
+	mu      sync.Mutex
+	ids     map[cache.Path]int
+	nextID  int
+	sources map[cache.Path]map[string]bool // vaults whose cache has the note
+	links   map[string]map[graph.Link]bool // links drawn for each vault
+}
+
+// key returns the qualified path and vault of a path in the cache of r.
+func key(r *resolver.Resolver, path cache.Path) (cache.Path, string) {
+	note, err := r.Resolve(path)
+	if err != nil {
+		return resolver.Qualify(r.Name(), path), r.Name()
 	}
+	return resolver.Qualify(note.Vault, note.RelativePath), note.Vault
+}
 
-	// noteToNode now uses note.Metadata directly, rather than fetching from cache
-	noteToNode := func(note cache.NoteEvent) graph.Node {
-		name := resolver.Title(note.Path, note.Metadata)
-		node := graph.Node{
-			Label:  name,
-			Grayed: note.Placeholder,
-			ID:     pathToId(note.Path),
+func (gv *graphView) id(key cache.Path) int {
+	if id, ok := gv.ids[key]; ok {
+		return id
+	}
+	gv.nextID++
+	gv.ids[key] = gv.nextID
+	return gv.nextID
+}
+
+// addSource records that the cache of a vault has the note at key. It
+// reports whether the note is new to the graph.
+func (gv *graphView) addSource(key cache.Path, vault string) bool {
+	sources := gv.sources[key]
+	if sources == nil {
+		sources = map[string]bool{}
+		gv.sources[key] = sources
+	}
+	sources[vault] = true
+	return len(sources) == 1
+}
+
+// clear removes what the cache of a vault added to the graph, ahead of the
+// snapshot that follows a Resync event.
+func (gv *graphView) clear(vault string) {
+	for link := range gv.links[vault] {
+		if err := graph.DeleteLink(link); err != nil {
+			log.Printf("graph.DeleteLink error: %v (link %+v)", err, link)
+		}
+	}
+	delete(gv.links, vault)
+	for k, sources := range gv.sources {
+		if !sources[vault] {
+			continue
+		}
+		delete(sources, vault)
+		if len(sources) == 0 {
+			if err := graph.DeleteNode(gv.ids[k]); err != nil {
+				log.Printf("graph.DeleteNode error: %v (note %s)", err, k)
+			}
+			delete(gv.ids, k)
+			delete(gv.sources, k)
 		}
-		return node
 	}
+}
 
-	linkToLink := func(link cache.LinkEvent) graph.Link {
-		return graph.Link{
-			Source: pathToId(link.Source),
-			Target: pathToId(link.Target),
+// ProcessEvents applies the events of a vault to the graph.
+func (gv *graphView) ProcessEvents(name string, r *resolver.Resolver, events <-chan cache.Event) {
+	noteToNode := func(k cache.Path, vault string, note cache.NoteEvent) graph.Node {
+		return graph.Node{
+			Label:  r.Title(note.Path, note.Metadata),
+			Grayed: note.Placeholder,
+			ID:     gv.id(k),
+			Vault:  vault,
 		}
 	}
 
 	for ev := range events {
+		gv.mu.Lock()
 		switch ev.Type {
 		case cache.CreateNote:
-			if err := graph.AddNode(noteToNode(*ev.Note)); err != nil {
-				log.Printf("graph.AddNode error: %v (event %+v)", err, ev)
+			k, vault := key(r, ev.Note.Path)
+			if gv.addSource(k, name) {
+				if err := graph.AddNode(noteToNode(k, vault, *ev.Note)); err != nil {
+					log.Printf("graph.AddNode error: %v (event %+v)", err, ev)
+				}
+			} else if vault == name {
+				// The owner knows better than the placeholders of other vaults.
+				if err := graph.UpdateNode(noteToNode(k, vault, *ev.Note)); err != nil {
+					log.Printf("graph.UpdateNode error: %v (event %+v)", err, ev)
+				}
 			}
 
 		case cache.UpdateNote:
-			// Preserve the existing node ID, but update its label from the new Metadata
-			id, _ := index[ev.Note.Path]
-			delete(index, ev.Note.Path)
+			k, _ := key(r, ev.Note.Path)
+			newKey, vault := key(r, ev.Note.NewPath)
 			ev.Note.Path = ev.Note.NewPath
-			index[ev.Note.NewPath] = id
-
-			// Use note.Metadata provided by the UpdateNote event
-			updatedNode := graph.Node{
-				Label:  resolver.Title(ev.Note.Path, ev.Note.Metadata),
-				Grayed: ev.Note.Placeholder,
-				ID:     id,
+			if k != newKey && len(gv.sources[k]) == 1 {
+				// Preserve the existing node ID, but update its label from the new Metadata
+				gv.ids[newKey] = gv.id(k)
+				gv.sources[newKey] = gv.sources[k]
+				delete(gv.ids, k)
+				delete(gv.sources, k)
+			} else if k != newKey {
+				// Other vaults still link to the old path.
+				delete(gv.sources[k], name)
+				if gv.addSource(newKey, name) {
+					if err := graph.AddNode(noteToNode(newKey, vault, *ev.Note)); err != nil {
+						log.Printf("graph.AddNode error: %v (event %+v)", err, ev)
+					}
+					break
+				}
 			}
-			if err := graph.UpdateNode(updatedNode); err != nil {
-				log.Printf("graph.UpdateNode error: %v (event %+v)", err, ev)
+			if vault == name || len(gv.sources[newKey]) == 1 {
+				if err := graph.UpdateNode(noteToNode(newKey, vault, *ev.Note)); err != nil {
+					log.Printf("graph.UpdateNode error: %v (event %+v)", err, ev)
+				}
 			}
 
 		case cache.DeleteNote:
-			if err := graph.DeleteNode(pathToId(ev.Note.Path)); err != nil {
-				log.Printf("graph.DeleteNode error: %v (event %+v)", err, ev)
+			k, _ := key(r, ev.Note.Path)
+			delete(gv.sources[k], name)
+			if len(gv.sources[k]) == 0 {
+				if err := graph.DeleteNode(gv.id(k)); err != nil {
+					log.Printf("graph.DeleteNode error: %v (event %+v)", err, ev)
+				}
+				delete(gv.ids, k)
+				delete(gv.sources, k)
 			}
 
 		case cache.CreateLink:
-			if err := graph.AddLink(linkToLink(*ev.Link)); err != nil {
+			source, _ := key(r, ev.Link.Source)
+			target, _ := key(r, ev.Link.Target)
+			link := graph.Link{Source: gv.id(source), Target: gv.id(target)}
+			if err := graph.AddLink(link); err != nil {
 				log.Printf("graph.AddLink error: %v (event %+v)", err, ev)
 			}
+			if gv.links[name] == nil {
+				gv.links[name] = map[graph.Link]bool{}
+			}
+			gv.links[name][link] = true
 
 		case cache.DeleteLink:
-			if err := graph.DeleteLink(linkToLink(*ev.Link)); err != nil {
+			source, _ := key(r, ev.Link.Source)
+			target, _ := key(r, ev.Link.Target)
+			link := graph.Link{Source: gv.id(source), Target: gv.id(target)}
+			if err := graph.DeleteLink(link); err != nil {
 				log.Printf("graph.DeleteLink error: %v (event %+v)", err, ev)
 			}
+			delete(gv.links[name], link)
+
+		case cache.Resync:
+			log.Printf("Graph view of %s missed %d events, redrawing", name, ev.Missed)
+			gv.clear(name)
 
 		default:
 			log.Printf("unknown Operation %q in event %+v", ev.Type, ev)
 		}
+		gv.mu.Unlock()
 	}
 }
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestOpenCommand(t *testing.T) {
+	s, v := newTestServer(t, map[string]string{"a.typ": `= A`}, nil)
+	a, err := v.resolver.Resolve("a.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shown := make(chan protocol.ShowDocumentParams, 1)
+	messages := make(chan protocol.ShowMessageParams, 1)
+	var failed atomic.Bool
+	conn := connect(t, s, func(req *jsonrpc2.Request) (any, error) {
+		switch protocol.Method(req.Method) {
+		case protocol.ServerWindowShowDocument:
+			var params protocol.ShowDocumentParams
+			if err := json.Unmarshal(*req.Params, &params); err != nil {
+				return nil, err
+			}
+			shown <- params
+			return protocol.ShowDocumentResult{Success: !failed.Load()}, nil
+		case protocol.ServerWindowShowMessage:
+			var params protocol.ShowMessageParams
+			if err := json.Unmarshal(*req.Params, &params); err != nil {
+				return nil, err
+			}
+			messages <- params
+		}
+		return nil, nil
+	})
+	open := func() {
+		t.Helper()
+		err := conn.Call(context.Background(), protocol.MethodWorkspaceExecuteCommand, protocol.ExecuteCommandParams{
+			Command:   "open",
+			Arguments: []any{a.URI},
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case params := <-shown:
+			if params.URI != a.URI {
+				t.Errorf("showed %s, want %s", params.URI, a.URI)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no window/showDocument request")
+		}
+	}
+
+	open()
+	select {
+	case m := <-messages:
+		t.Errorf("got message %q after the document was shown", m.Message)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	failed.Store(true)
+	open()
+	select {
+	case m := <-messages:
+		if m.Type != protocol.MessageTypeWarning {
+			t.Errorf("got message %+v, want a warning", m)
+		}
+	case <-time.After(time.Second):
+		t.Error("no message after the client could not show the document")
+	}
+}
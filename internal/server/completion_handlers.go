@@ -0,0 +1,99 @@
+package server
+
+import (
+	"zeta/internal/resolver"
+	"zeta/internal/sitteradapter"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func (s *Server) textDocumentCompletion(
+	context *glsp.Context,
+	params *protocol.CompletionParams,
+) (any, error) {
+	v, source, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	nodes, doc, err := v.manager.Query(source.URI, s.config.Query)
+	if err != nil {
+		return nil, err
+	}
+	index := params.Position.IndexIn(string(doc))
+
+	// Find the (selected part of the) target capture under the cursor.
+	for _, n := range nodes["target"] {
+		if index < int(n.StartByte()) || index > int(n.EndByte()) {
+			continue
+		}
+		start, end, ok := v.resolver.SelectIndex(n.Content(doc))
+		if !ok {
+			continue
+		}
+		from, to := int(n.StartByte())+start, int(n.StartByte())+end
+		if index < from || index > to {
+			continue
+		}
+		editRange := protocol.Range{
+			Start: sitteradapter.OffsetToLSPPosition(from, string(doc)),
+			End:   sitteradapter.OffsetToLSPPosition(to, string(doc)),
+		}
+		prefix := string(doc[from:index])
+		return s.linkCompletions(v, source, prefix, editRange), nil
+	}
+	return nil, nil
+}
+
+// linkCompletions offers every known note as a reference target, written
+// in the same style (relative or root) as the prefix that was typed so far.
+// Notes of other vaults are offered as vault:path.
+func (s *Server) linkCompletions(
+	v *vault,
+	source resolver.Note,
+	prefix string,
+	editRange protocol.Range,
+) protocol.CompletionList {
+	max_results := 128
+	relative := resolver.IsRelativeReference(prefix)
+	kind := protocol.CompletionItemKindFile
+
+	items := []protocol.CompletionItem{} // empty, not nil
+vaults:
+	for _, u := range s.vaults {
+		for _, path := range u.cache.GetPaths() {
+			target, err := u.resolver.Resolve(path)
+			// Links to other vaults are offered by the vault they point to.
+			if err != nil || target.Vault != u.name || target.URI == source.URI {
+				continue
+			}
+			label := s.title(target)
+			insert := v.resolver.Reference(source, target, relative, true)
+			if !isSubsequence(prefix, insert) && !isSubsequence(prefix, label) {
+				continue
+			}
+
+			detail := path
+			if u != v {
+				detail = resolver.Qualify(u.name, path)
+			}
+			if !u.cache.NoteExists(path) {
+				detail += " (not yet created)"
+			}
+			filter := insert + " " + label
+			items = append(items, protocol.CompletionItem{
+				Label:      label,
+				Kind:       &kind,
+				Detail:     &detail,
+				FilterText: &filter,
+				TextEdit:   protocol.TextEdit{Range: editRange, NewText: insert},
+			})
+			if len(items) == max_results {
+				break vaults
+			}
+		}
+	}
+
+	// The result depends on the prefix, so the client must ask again.
+	return protocol.CompletionList{IsIncomplete: true, Items: items}
+}
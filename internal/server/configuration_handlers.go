@@ -0,0 +1,199 @@
+package server
+
+import (
+	"log"
+	"reflect"
+	"zeta/internal/config"
+	"zeta/internal/ignore"
+	"zeta/internal/resolver"
+	"zeta/internal/search"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// configurationSection is the section of the client settings zeta reads.
+const configurationSection = "zeta"
+
+func (s *Server) workspaceDidChangeConfiguration(
+	context *glsp.Context,
+	params *protocol.DidChangeConfigurationParams,
+) error {
+	settings := params.Settings
+	if m, ok := settings.(map[string]any); ok {
+		if section, ok := m[configurationSection]; ok {
+			settings = section
+		}
+	}
+	// Pulling the configuration is a request to the client, which must not
+	// block the handler. Reconfiguring waits for running handlers anyway.
+	go func() {
+		if s.pullsConfiguration() {
+			pulled, err := s.pullConfiguration()
+			if err != nil {
+				log.Printf("Error pulling configuration: %v", err)
+				return
+			}
+			settings = pulled
+		}
+		s.reconfigure(settings)
+	}()
+	return nil
+}
+
+// watchConfiguration registers for configuration changes and pulls the
+// current settings, if the client supports it.
+func (s *Server) watchConfiguration(ctx *glsp.Context) {
+	workspace := s.capabilities.Workspace
+	register := workspace != nil && workspace.DidChangeConfiguration != nil &&
+		workspace.DidChangeConfiguration.DynamicRegistration != nil &&
+		*workspace.DidChangeConfiguration.DynamicRegistration
+	pull := s.pullsConfiguration()
+
+	go func() {
+		if register {
+			params := protocol.RegistrationParams{
+				Registrations: []protocol.Registration{
+					{
+						ID:     "zeta-configuration",
+						Method: string(protocol.MethodWorkspaceDidChangeConfiguration),
+					},
+				},
+			}
+			ctx.Call(string(protocol.ServerClientRegisterCapability), params, nil)
+		}
+		if pull {
+			settings, err := s.pullConfiguration()
+			if err != nil {
+				log.Printf("Error pulling configuration: %v", err)
+				return
+			}
+			s.reconfigure(settings)
+		}
+	}()
+}
+
+// pullsConfiguration reports whether the client answers workspace/configuration.
+func (s *Server) pullsConfiguration() bool {
+	workspace := s.capabilities.Workspace
+	return workspace != nil && workspace.Configuration != nil && *workspace.Configuration
+}
+
+// pullConfiguration asks the client for the zeta section of its settings,
+// which is nil if the client has none.
+func (s *Server) pullConfiguration() (any, error) {
+	section := configurationSection
+	params := protocol.ConfigurationParams{
+		Items: []protocol.ConfigurationItem{{Section: &section}},
+	}
+	var result []any
+	if err := s.call(string(protocol.ServerWorkspaceConfiguration), params, &result); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result[0], nil
+}
+
+// reconfigure applies settings on top of the initialization options. Any
+// change swaps in the caches of the new configuration, re-indexes the notes
+// under it and redraws connected graph viewers.
+func (s *Server) reconfigure(settings any) {
+	cfg, err := config.Merge(s.initConfig, settings)
+	if err != nil {
+		log.Printf("Error reading configuration: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if reflect.DeepEqual(cfg, s.config) {
+		return
+	}
+	log.Printf("Config: %v", cfg)
+	if cfg.Query != s.config.Query && s.registersSemanticTokens() {
+		s.tokenTypes = semanticTokenTypes(cfg.Query)
+		go s.reregisterSemanticTokens(s.semanticTokensOptions())
+	}
+	s.config = cfg
+	for _, v := range s.vaults {
+		if err := s.reconfigureVault(v); err != nil {
+			log.Printf("Error reconfiguring %s: %v", v.name, err)
+		}
+	}
+	if err := s.listen(); err != nil {
+		log.Printf("Error subscribing to cache: %v", err)
+	}
+}
+
+// reconfigureVault swaps in the resolver and cache of the current
+// configuration and re-indexes the vault.
+func (s *Server) reconfigureVault(v *vault) error {
+	r, err := newResolver(v.root, s.config)
+	if err != nil {
+		return err
+	}
+	cacheFile, err := cachePath(v.root, s.config)
+	if err != nil {
+		return err
+	}
+
+	v.stopScan()
+	v.flush()
+	v.resolver = r.WithVaults(v.name, &s.roots)
+	v.manager.SetResolver(v.resolver)
+	v.cacheFile = cacheFile
+	v.cache = openCache(cacheFile)
+	v.flushed.Store(0) // the generation of a freshly opened cache
+	v.search = search.NewIndex()
+
+	// Open documents may differ from disk, so they are queried as they are.
+	for _, uri := range v.manager.URIs() {
+		note, err := v.resolver.Resolve(uri)
+		if err != nil {
+			continue
+		}
+		links, meta, err := v.manager.GetLinksAndMeta(note.URI, s.config.Query)
+		if err != nil {
+			log.Printf("Error indexing %s: %v", uri, err)
+			continue
+		}
+		if err := v.cache.EditNote(note.CachePath, links, meta); err != nil {
+			log.Printf("Error indexing %s: %v", uri, err)
+			continue
+		}
+		if document, err := v.manager.GetDocument(note.URI); err == nil {
+			v.search.Put(note.CachePath, search.Analyze(document))
+		}
+		publishDiagnostics(s.client, note.URI, s.noteDiagnostics(v, note.URI, links))
+	}
+
+	s.scan(v)
+	if v.stopPoll != nil {
+		v.stopPoll()
+		s.poll(v)
+	}
+	return nil
+}
+
+// newResolver creates the resolver for a configuration.
+func newResolver(root string, cfg config.Config) (*resolver.Resolver, error) {
+	r, err := resolver.New(
+		root,
+		cfg.SelectRegex,
+		cfg.FileExtensions,
+		cfg.DefaultExtension,
+		cfg.TitleTemplate,
+		cfg.TitleSubstitutions,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ignore.Load(root, cfg.UseGitignore, cfg.Ignore)
+	if err != nil {
+		return nil, err
+	}
+	return r.WithIgnore(m), nil
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"testing"
+	"zeta/internal/config"
+)
+
+func TestReconfigure(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	s, v := newTestServer(t, map[string]string{"a.typ": `= A`}, nil)
+	initConfig, err := config.Merge(s.config, map[string]any{"hover_lines": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.initConfig, s.config = initConfig, initConfig
+	reconfigure := func(settings any) {
+		t.Helper()
+		s.reconfigure(settings)
+		<-v.progress.done
+	}
+
+	// Settings overlay the initialization options, field by field.
+	r := v.resolver
+	reconfigure(map[string]any{"link_hints": LinkHintsDiagnostic})
+	if s.config.HoverLines != 3 || s.config.LinkHints != LinkHintsDiagnostic {
+		t.Errorf("got hover_lines %d and link_hints %q, want 3 and %q",
+			s.config.HoverLines, s.config.LinkHints, LinkHintsDiagnostic)
+	}
+	if v.resolver == r {
+		t.Error("kept the resolver of the old configuration")
+	}
+
+	// Invalid settings keep the configuration.
+	want := s.config
+	reconfigure(map[string]any{"hover_lines": "many"})
+	if s.config.HoverLines != want.HoverLines || s.config.LinkHints != want.LinkHints {
+		t.Errorf("applied invalid settings: got %+v", s.config)
+	}
+
+	// Without settings, the initialization options apply again.
+	reconfigure(nil)
+	if s.config.HoverLines != 3 || s.config.LinkHints != initConfig.LinkHints {
+		t.Errorf("got hover_lines %d and link_hints %q, want 3 and %q",
+			s.config.HoverLines, s.config.LinkHints, initConfig.LinkHints)
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/tliron/glsp"
+	"github.com/tliron/glsp/server"
+)
+
+// RunStdio serves the client on stdin and stdout until it disconnects.
+//
+// glsp hands its handlers a context that is cancelled as soon as the
+// connection is set up, which fails every request to the client. zeta sends
+// those long after the handler returned, so it serves the connection itself,
+// with a context that lasts as long as the connection.
+func (s *Server) RunStdio() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.ctx = ctx
+	conn := jsonrpc2.NewConn(
+		ctx,
+		jsonrpc2.NewBufferedStream(server.Stdio{}, jsonrpc2.VSCodeObjectCodec{}),
+		indexHandler{s, jsonrpc2.HandlerWithError(s.handle)},
+	)
+	s.conn.Store(conn)
+	<-conn.DisconnectNotify()
+	return nil
+}
+
+// indexHandler holds back the requests that need every note while the
+// vaults are scanned, for at most scanTimeout. They wait on their own, since
+// messages are dispatched one after the other, and waiting in a handler
+// would hold up everything after them.
+type indexHandler struct {
+	s *Server
+	jsonrpc2.Handler
+}
+
+func (h indexHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if !needsIndex(req) {
+		h.Handler.Handle(ctx, conn, req)
+		return
+	}
+	scans := h.s.runningScans()
+	if len(scans) == 0 {
+		h.Handler.Handle(ctx, conn, req)
+		return
+	}
+	go func() {
+		awaitScans(scans)
+		h.Handler.Handle(ctx, conn, req)
+	}()
+}
+
+// handle dispatches a message of the client to the handler, as glsp does.
+func (s *Server) handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+	glspContext := glsp.Context{
+		Method: req.Method,
+		Notify: func(method string, params any) {
+			if err := conn.Notify(ctx, method, params); err != nil {
+				log.Printf("Error notifying %s: %v", method, err)
+			}
+		},
+		Call: func(method string, params any, result any) {
+			if err := conn.Call(ctx, method, params, result); err != nil {
+				log.Printf("Error calling %s: %v", method, err)
+			}
+		},
+		Context: ctx,
+	}
+	if req.Params != nil {
+		glspContext.Params = *req.Params
+	}
+
+	result, validMethod, validParams, err := s.dispatch.Handle(&glspContext)
+	if req.Method == "exit" {
+		// The result does not matter, the client is gone.
+		return nil, conn.Close()
+	}
+	switch {
+	case !validMethod:
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeMethodNotFound,
+			Message: fmt.Sprintf("method not supported: %s", req.Method),
+		}
+	case !validParams:
+		e := &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		if err != nil {
+			e.Message = err.Error()
+		}
+		return nil, e
+	case err != nil:
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidRequest, Message: err.Error()}
+	}
+	return result, nil
+}
+
+// call sends a request to the client and waits for the answer. Unlike
+// glsp.Context.Call, it reports when the request failed.
+func (s *Server) call(method string, params any, result any) error {
+	conn := s.conn.Load()
+	if conn == nil {
+		return fmt.Errorf("%s: not connected", method)
+	}
+	return conn.Call(s.ctx, method, params, result)
+}
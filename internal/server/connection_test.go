@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+	"zeta/internal/cache"
+
+	"github.com/sourcegraph/jsonrpc2"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// connect serves s on one end of a pipe and returns a connection to the
+// other, on which client answers the requests of the server.
+func connect(t *testing.T, s *Server, client func(*jsonrpc2.Request) (any, error)) *jsonrpc2.Conn {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	server, clientEnd := net.Pipe()
+	s.ctx = ctx
+	s.conn.Store(jsonrpc2.NewConn(
+		ctx,
+		jsonrpc2.NewBufferedStream(server, jsonrpc2.VSCodeObjectCodec{}),
+		indexHandler{s, jsonrpc2.HandlerWithError(s.handle)},
+	))
+	conn := jsonrpc2.NewConn(
+		ctx,
+		jsonrpc2.NewBufferedStream(clientEnd, jsonrpc2.VSCodeObjectCodec{}),
+		jsonrpc2.HandlerWithError(func(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+			if client == nil {
+				return nil, nil
+			}
+			return client(req)
+		}),
+	)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestRequestDuringScan(t *testing.T) {
+	s, v := newTestServer(t,
+		map[string]string{
+			"a.typ": `#link("c")`,
+			"b.typ": `#link("c")`,
+			"c.typ": `= C`,
+		},
+		map[string][]cache.Link{"a.typ": {link("a.typ", "c.typ", 6, 9)}},
+	)
+	v.progress = newScanProgress() // b.typ is not scanned yet
+	conn := connect(t, s, nil)
+	c, err := v.resolver.Resolve("c.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	references := make(chan []protocol.Location)
+	go func() {
+		var locations []protocol.Location
+		err := conn.Call(context.Background(), protocol.MethodTextDocumentReferences, protocol.ReferenceParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: c.URI},
+			},
+		}, &locations)
+		if err != nil {
+			t.Error(err)
+		}
+		references <- locations
+	}()
+
+	// Requests that do not need every note are answered in the meantime.
+	err = conn.Call(context.Background(), protocol.MethodWorkspaceExecuteCommand, protocol.ExecuteCommandParams{
+		Command: "unknown",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case locations := <-references:
+		t.Fatalf("answered %v before the scan finished", locations)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	links := []cache.Link{link("b.typ", "c.typ", 6, 9)}
+	if err := v.cache.SaveNote("b.typ", links, nil, cache.NewFileState([]byte(`#link("c")`), time.Now())); err != nil {
+		t.Fatal(err)
+	}
+	close(v.progress.done)
+	a, _ := v.resolver.Resolve("a.typ")
+	b, _ := v.resolver.Resolve("b.typ")
+	want := []protocol.Location{
+		{URI: a.URI, Range: links[0].Ranges[0]},
+		{URI: b.URI, Range: links[0].Ranges[0]},
+	}
+	select {
+	case locations := <-references:
+		if !reflect.DeepEqual(locations, want) && !reflect.DeepEqual(locations, []protocol.Location{want[1], want[0]}) {
+			t.Errorf("got %v, want %v", locations, want)
+		}
+	case <-time.After(scanTimeout):
+		t.Fatal("no answer once the scan finished")
+	}
+}
@@ -12,54 +12,80 @@ func (s *Server) textDocumentDefinition(
 	context *glsp.Context,
 	params *protocol.DefinitionParams,
 ) (any, error) {
-	note, _ := resolver.Resolve(params.TextDocument.URI)
+	target, _, err := s.linkAt(params.TextDocument.URI, params.Position)
+	if err != nil || target == nil {
+		return nil, err
+	}
+
+	if s.noteExists(*target) {
+		return protocol.Location{
+			URI: target.URI,
+			Range: protocol.Range{
+				Start: protocol.Position{Line: 0, Character: 0},
+				End:   protocol.Position{Line: 0, Character: 0},
+			},
+		}, nil
+	}
+	context.Notify(
+		"window/showDocument",
+		protocol.ShowDocumentParams{
+			URI:      protocol.URI(target.URI),
+			External: &protocol.False,
+		},
+	)
+	return nil, nil
+}
 
-	refs, err := s.cache.GetForwardLinks(note.CachePath)
+// linkAt returns the target of the forward link whose range contains the
+// position, together with that range. It returns nil if there is no link.
+func (s *Server) linkAt(
+	uri protocol.DocumentUri,
+	position protocol.Position,
+) (*resolver.Note, *protocol.Range, error) {
+	v, note, err := s.vaultOf(uri)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	doc, err := s.manager.GetDocument(note.URI)
+
+	refs, err := v.cache.GetForwardLinks(note.CachePath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	doc, err := v.manager.GetDocument(note.URI)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	index := position.IndexIn(string(doc))
 	for _, ref := range refs {
 		for _, r := range ref.Ranges {
 			indexFrom, indexTo := r.IndexesIn(string(doc))
-			index := params.TextDocumentPositionParams.Position.IndexIn(string(doc))
-
 			if index >= indexFrom && index <= indexTo {
-				target, _ := resolver.Resolve(ref.Target)
-				if s.cache.NoteExists(target.RelativePath) {
-					return protocol.Location{
-						URI: target.URI,
-						Range: protocol.Range{
-							Start: protocol.Position{Line: 0, Character: 0},
-							End:   protocol.Position{Line: 0, Character: 0},
-						},
-					}, nil
+				target, err := v.resolver.Resolve(ref.Target)
+				if err != nil {
+					return nil, nil, err
 				}
-				context.Notify(
-					"window/showDocument",
-					protocol.ShowDocumentParams{
-						URI:      protocol.URI(target.URI),
-						External: &protocol.False,
-					},
-				)
-				return nil, nil
+				return &target, &r, nil
 			}
 		}
 	}
-	return nil, nil
+	return nil, nil, nil
 }
 
 func (s *Server) textDocumentReferences(
 	context *glsp.Context,
 	params *protocol.ReferenceParams,
 ) ([]protocol.Location, error) {
-	note, _ := resolver.Resolve(params.TextDocument.URI)
+	_, note, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return s.backlinkLocations(note)
+}
 
-	refs, err := s.cache.GetBackLinks(note.CachePath)
+// backlinkLocations returns the location of every link to the note.
+func (s *Server) backlinkLocations(note resolver.Note) ([]protocol.Location, error) {
+	refs, err := s.incomingLinks(note)
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +93,7 @@ func (s *Server) textDocumentReferences(
 	var locations []protocol.Location
 	for _, ref := range refs {
 		for _, r := range ref.Ranges {
-			source, _ := resolver.Resolve(ref.Source)
+			source, _ := ref.vault.resolver.Resolve(ref.Source)
 			locations = append(locations, protocol.Location{URI: source.URI, Range: r})
 		}
 	}
@@ -82,24 +108,29 @@ func (s *Server) workspaceSymbol(
 	max_results := 128
 	query := params.Query
 
-	notes := s.cache.GetPaths()
 	counter := 0
 
 	var symbols []protocol.SymbolInformation
 
-	for _, note := range notes {
-		meta, _ := s.cache.GetMetaData(note)
-		name := resolver.Title(note, meta)
-		if isSubsequence(query, name) {
-			resolved, _ := resolver.Resolve(note)
-			symbols = append(symbols, protocol.SymbolInformation{
-				Name:     name,
-				Kind:     protocol.SymbolKindFile,
-				Location: protocol.Location{URI: resolved.URI},
-			})
-			counter += 1
-			if counter == max_results {
-				break
+vaults:
+	for _, v := range s.vaults {
+		for _, path := range v.cache.GetPaths() {
+			note, err := v.resolver.Resolve(path)
+			if err != nil || note.Vault != v.name {
+				continue // notes of other vaults are listed by their own vault
+			}
+			name := s.title(note)
+			if isSubsequence(query, name) {
+				symbols = append(symbols, protocol.SymbolInformation{
+					Name:          name,
+					Kind:          protocol.SymbolKindFile,
+					Location:      protocol.Location{URI: note.URI},
+					ContainerName: &v.name,
+				})
+				counter += 1
+				if counter == max_results {
+					break vaults
+				}
 			}
 		}
 	}
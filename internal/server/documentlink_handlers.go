@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"zeta/internal/resolver"
+	"zeta/internal/sitteradapter"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func (s *Server) textDocumentDocumentLink(
+	context *glsp.Context,
+	params *protocol.DocumentLinkParams,
+) ([]protocol.DocumentLink, error) {
+	v, note, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	nodes, doc, err := v.manager.Query(note.URI, s.config.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	links := []protocol.DocumentLink{} // empty, not nil
+	for _, n := range nodes["target"] {
+		r := protocol.Range{
+			Start: sitteradapter.TSPointToLSPPosition(n.StartPoint(), string(doc)),
+			End:   sitteradapter.TSPointToLSPPosition(n.EndPoint(), string(doc)),
+		}
+		link := protocol.DocumentLink{Range: r}
+
+		target, err := v.resolver.ResolveReference(note, n.Content(doc))
+		if err != nil {
+			tooltip := s.unresolvedReason(err)
+			link.Tooltip = &tooltip
+		} else {
+			tooltip := s.title(target)
+			if !s.noteExists(target) {
+				tooltip += " (not yet created)"
+			}
+			link.Target = &target.URI
+			link.Tooltip = &tooltip
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// unresolvedReason explains why a reference could not be resolved.
+func (s *Server) unresolvedReason(err error) string {
+	switch {
+	case errors.Is(err, resolver.ErrEmptyReference):
+		return "Unresolved: the reference is empty"
+	case errors.Is(err, resolver.ErrDirectoryReference):
+		return "Unresolved: references cannot point to directories"
+	case errors.Is(err, resolver.ErrInvalidExtension):
+		return "Unresolved: the target must have one of the extensions " +
+			strings.Join(s.config.FileExtensions, ", ")
+	case errors.Is(err, resolver.ErrInvalidReference):
+		return "Unresolved: the reference does not match the select_regex"
+	default:
+		return "Unresolved: " + err.Error()
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"zeta/internal/sitteradapter"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// outlineItem is a document symbol under construction.
+type outlineItem struct {
+	symbol   protocol.DocumentSymbol
+	level    int // heading level, 0 for anything that is not a heading
+	start    int // byte offsets of the full range
+	end      int
+	children []*outlineItem
+}
+
+func (s *Server) textDocumentDocumentSymbol(
+	context *glsp.Context,
+	params *protocol.DocumentSymbolParams,
+) (any, error) {
+	v, note, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	results, doc, err := v.manager.Queries(note.URI, s.config.OutlineQuery, s.config.Query)
+	if err != nil {
+		return nil, err
+	}
+	outline, captures := results[0], results[1]
+
+	var items []*outlineItem
+	for name, nodes := range outline {
+		for _, n := range nodes {
+			if name == "heading" {
+				items = append(items, headingItem(n, doc))
+			} else {
+				items = append(items, captureItem(n, doc, name))
+			}
+		}
+	}
+	for _, n := range captures["target"] {
+		item := captureItem(n, doc, "link")
+		item.symbol.Kind = protocol.SymbolKindFile
+		if target, err := v.resolver.ResolveReference(note, n.Content(doc)); err == nil {
+			item.symbol.Name = s.title(target)
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].start < items[j].start })
+
+	// A heading spans up to the next heading of the same or a higher level.
+	for i, item := range items {
+		if item.level == 0 {
+			continue
+		}
+		item.end = len(doc)
+		for _, next := range items[i+1:] {
+			if next.level > 0 && next.level <= item.level {
+				item.end = next.start
+				break
+			}
+		}
+		item.symbol.Range.End = sitteradapter.OffsetToLSPPosition(item.end, string(doc))
+	}
+
+	// Nest every item in the innermost heading that contains it.
+	root := &outlineItem{end: len(doc)}
+	stack := []*outlineItem{root}
+	for _, item := range items {
+		for len(stack) > 1 && item.start >= stack[len(stack)-1].end {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, item)
+		if item.level > 0 {
+			stack = append(stack, item)
+		}
+	}
+	return root.documentSymbols(), nil
+}
+
+// documentSymbols converts the children of an item into document symbols.
+func (item *outlineItem) documentSymbols() []protocol.DocumentSymbol {
+	symbols := []protocol.DocumentSymbol{} // empty, not nil
+	for _, child := range item.children {
+		symbol := child.symbol
+		if len(child.children) > 0 {
+			symbol.Children = child.documentSymbols()
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// headingItem builds an outline item for a heading. Its level is the number
+// of leading "=" on its line.
+func headingItem(n *sitter.Node, doc []byte) *outlineItem {
+	start := int(n.StartByte())
+	lineStart := strings.LastIndexByte(string(doc[:start]), '\n') + 1
+	line := strings.TrimSpace(string(doc[lineStart:n.EndByte()]))
+	name := strings.TrimLeft(line, "=")
+	level := len(line) - len(name)
+	if level == 0 {
+		level = 1
+	}
+	name, _, _ = strings.Cut(strings.TrimSpace(name), "\n")
+
+	item := captureItem(n, doc, "heading")
+	item.symbol.Name = name
+	item.symbol.Kind = protocol.SymbolKindNamespace
+	item.symbol.Detail = nil
+	item.level = level
+	return item
+}
+
+// captureItem builds an outline item for an arbitrary capture.
+func captureItem(n *sitter.Node, doc []byte, captureName string) *outlineItem {
+	r := protocol.Range{
+		Start: sitteradapter.TSPointToLSPPosition(n.StartPoint(), string(doc)),
+		End:   sitteradapter.TSPointToLSPPosition(n.EndPoint(), string(doc)),
+	}
+	name, _, _ := strings.Cut(strings.TrimSpace(n.Content(doc)), "\n")
+	if name == "" {
+		name = captureName
+	}
+	return &outlineItem{
+		symbol: protocol.DocumentSymbol{
+			Name:           name,
+			Detail:         &captureName,
+			Kind:           protocol.SymbolKindProperty,
+			Range:          r,
+			SelectionRange: r,
+		},
+		start: int(n.StartByte()),
+		end:   int(n.EndByte()),
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// customFunc handles a request that protocol.Handler does not know about.
+type customFunc func(context *glsp.Context) (r any, validParams bool, err error)
+
+// customRequest adapts a typed handler to a customFunc.
+func customRequest[P any](f func(context *glsp.Context, params *P) (any, error)) customFunc {
+	return func(context *glsp.Context) (any, bool, error) {
+		var params P
+		if err := json.Unmarshal(context.Params, &params); err != nil {
+			return nil, false, err
+		}
+		r, err := f(context, &params)
+		return r, true, err
+	}
+}
+
+// handler extends protocol.Handler with custom and newer (3.17) methods.
+// Requests hold a read lock on mu, so reconfiguring can swap out the state
+// they use.
+type handler struct {
+	*protocol.Handler
+	custom map[string]customFunc
+	mu     *sync.RWMutex
+}
+
+func (h *handler) Handle(context *glsp.Context) (r any, validMethod bool, validParams bool, err error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	f, ok := h.custom[context.Method]
+	if !ok {
+		return h.Handler.Handle(context)
+	}
+	if !h.IsInitialized() {
+		return nil, true, true, errors.New("server not initialized")
+	}
+	r, validParams, err = f(context)
+	return r, true, validParams, err
+}
+
+// serverCapabilities extends protocol.ServerCapabilities with capabilities
+// of methods handled by handler.custom.
+type serverCapabilities struct {
+	protocol.ServerCapabilities
+	InlayHintProvider any `json:"inlayHintProvider,omitempty"`
+}
+
+// initializeResult is protocol.InitializeResult with serverCapabilities.
+type initializeResult struct {
+	Capabilities serverCapabilities `json:"capabilities"`
+}
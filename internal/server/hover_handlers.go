@@ -0,0 +1,104 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"zeta/internal/resolver"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func (s *Server) textDocumentHover(
+	context *glsp.Context,
+	params *protocol.HoverParams,
+) (*protocol.Hover, error) {
+	target, r, err := s.linkAt(params.TextDocument.URI, params.Position)
+	if err != nil || target == nil {
+		return nil, err
+	}
+	return &protocol.Hover{
+		Contents: protocol.MarkupContent{
+			Kind:  protocol.MarkupKindMarkdown,
+			Value: s.notePreview(*target),
+		},
+		Range: r,
+	}, nil
+}
+
+// notePreview renders a markdown preview of a note. The content is taken
+// from the open document if there is one, and from disk otherwise.
+func (s *Server) notePreview(note resolver.Note) string {
+	meta := s.metadata(note)
+	backlinks, _ := s.incomingLinks(note)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s\n\n", s.title(note))
+	fmt.Fprintf(&b, "`%s` · %d backlinks\n\n", note.CachePath, len(backlinks))
+
+	if !s.noteExists(note) {
+		b.WriteString("_This note is a placeholder and has not been created yet._\n")
+		return b.String()
+	}
+
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "- **%s**: %s\n", k, meta[k])
+	}
+	if len(keys) > 0 {
+		b.WriteString("\n")
+	}
+
+	if s.config.HoverLines <= 0 {
+		return b.String()
+	}
+	doc, err := s.readDocument(note)
+	if err != nil {
+		return b.String()
+	}
+	body := noteBody(string(doc))
+	if body == "" {
+		return b.String()
+	}
+	lines := strings.SplitN(body, "\n", s.config.HoverLines+1)
+	if len(lines) > s.config.HoverLines {
+		lines = append(lines[:s.config.HoverLines], "...")
+	}
+	fmt.Fprintf(&b, "```typst\n%s\n```\n", strings.Join(lines, "\n"))
+	return b.String()
+}
+
+// frontMatter are the prefixes of the lines that set up a note rather than
+// being part of its content.
+var frontMatter = []string{"#import", "#include", "#set", "#show", "#let", "#metadata"}
+
+// noteBody returns a note without its front matter: the leading blank lines,
+// set up code and the first heading, which the preview shows as the title.
+// Set up code may span several lines, up to its closing bracket.
+func noteBody(doc string) string {
+	lines := strings.Split(doc, "\n")
+	heading := false
+	depth := 0 // of the brackets still open in the set up code
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case depth > 0, line == "":
+		case !heading && strings.HasPrefix(line, "="):
+			heading = true
+			continue
+		case slices.ContainsFunc(frontMatter, func(p string) bool { return strings.HasPrefix(line, p) }):
+		default:
+			return strings.TrimRight(strings.Join(lines[i:], "\n"), "\n")
+		}
+		depth += strings.Count(line, "(") + strings.Count(line, "[") + strings.Count(line, "{")
+		depth -= strings.Count(line, ")") + strings.Count(line, "]") + strings.Count(line, "}")
+		depth = max(depth, 0)
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNotePreviewSkipsFrontMatter(t *testing.T) {
+	s, v := newTestServer(t,
+		map[string]string{
+			"a.typ": strings.Join([]string{
+				`#import "template.typ": *`,
+				`#set document(`,
+				`  title: "A",`,
+				`)`,
+				``,
+				`= A <note>`,
+				``,
+				`First line.`,
+				`= Section`,
+				`Second line.`,
+				`Third line.`,
+				``,
+			}, "\n"),
+		},
+		nil,
+	)
+	s.config.HoverLines = 3
+	a, err := v.resolver.Resolve("a.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preview := s.notePreview(a)
+	want := "```typst\nFirst line.\n= Section\nSecond line.\n...\n```\n"
+	if !strings.HasSuffix(preview, want) {
+		t.Errorf("preview is\n%s\nwant it to end with\n%s", preview, want)
+	}
+}
+
+func TestNoteBody(t *testing.T) {
+	for doc, want := range map[string]string{
+		"= Title\nBody\n":            "Body",
+		"Body\n= Heading\n":          "Body\n= Heading",
+		"#let x = 1\n\n\nBody":       "Body",
+		"#show: note.with(\n)\nBody": "Body",
+		"= Title\n\n":                "",
+	} {
+		if got := noteBody(doc); got != want {
+			t.Errorf("noteBody(%q) = %q, want %q", doc, got, want)
+		}
+	}
+}
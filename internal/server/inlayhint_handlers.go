@@ -0,0 +1,77 @@
+package server
+
+import (
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Inlay hints were introduced in LSP 3.17, which glsp does not implement.
+
+const MethodTextDocumentInlayHint = "textDocument/inlayHint"
+
+type InlayHintParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+	Range        protocol.Range                  `json:"range"`
+}
+
+type InlayHint struct {
+	Position    protocol.Position `json:"position"`
+	Label       string            `json:"label"`
+	Tooltip     *string           `json:"tooltip,omitempty"`
+	PaddingLeft *bool             `json:"paddingLeft,omitempty"`
+}
+
+// Values of the link_hints option.
+const (
+	LinkHintsInlay      = "inlay"
+	LinkHintsDiagnostic = "diagnostic"
+)
+
+func (s *Server) textDocumentInlayHint(
+	context *glsp.Context,
+	params *InlayHintParams,
+) (any, error) {
+	hints := []InlayHint{} // empty, not nil
+	if s.config.LinkHints != LinkHintsInlay {
+		return hints, nil
+	}
+
+	v, note, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	links, err := v.cache.GetForwardLinks(note.CachePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		target, err := v.resolver.Resolve(l.Target)
+		if err != nil {
+			continue
+		}
+		title := s.title(target)
+		tooltip := l.Target
+		if !s.noteExists(target) {
+			tooltip += " (not yet created)"
+		}
+		for _, r := range l.Ranges {
+			if !inRange(r.End, params.Range) {
+				continue
+			}
+			hints = append(hints, InlayHint{
+				Position:    r.End,
+				Label:       title,
+				Tooltip:     &tooltip,
+				PaddingLeft: &protocol.True,
+			})
+		}
+	}
+	return hints, nil
+}
+
+// inRange reports whether the position lies within the range.
+func inRange(p protocol.Position, r protocol.Range) bool {
+	after := p.Line > r.Start.Line || (p.Line == r.Start.Line && p.Character >= r.Start.Character)
+	before := p.Line < r.End.Line || (p.Line == r.End.Line && p.Character <= r.End.Character)
+	return after && before
+}
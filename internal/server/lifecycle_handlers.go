@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -18,11 +19,15 @@ import (
 	"zeta/internal/parser"
 	"zeta/internal/resolver"
 	"zeta/internal/scanner"
+	"zeta/internal/search"
 
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 )
 
+// flushInterval is how often the caches that changed are written to disk.
+const flushInterval = 30 * time.Second
+
 func (s *Server) initialize(
 	context *glsp.Context,
 	params *protocol.InitializeParams,
@@ -33,131 +38,326 @@ func (s *Server) initialize(
 	}
 
 	s.config = config
+	s.initConfig = config
 	log.Printf("Config: %v", config)
+	s.capabilities = params.Capabilities
+	s.tokenTypes = semanticTokenTypes(config.Query)
+
+	// Parsers
+	// One parser per scan worker, but at least 10 for the other requests.
+	s.parsers = parser.NewParserPool(max(10, config.ScanWorkers))
+
+	// Vaults, one per workspace folder.
+	folders := params.WorkspaceFolders
+	if len(folders) == 0 && params.RootURI != nil {
+		folders = []protocol.WorkspaceFolder{{URI: *params.RootURI}}
+	}
+	for _, folder := range folders {
+		if err := s.addVault(folder); err != nil {
+			return nil, err
+		}
+	}
+
+	// Start cache flush routine.
+	ticker := time.NewTicker(flushInterval)
+	go func() {
+		for range ticker.C {
+			s.mu.RLock()
+			s.flush()
+			s.mu.RUnlock()
+		}
+	}()
+
+	syncKind := protocol.TextDocumentSyncKindIncremental
+
+	capabilities := s.handler.CreateServerCapabilities()
+	capabilities.TextDocumentSync = &protocol.TextDocumentSyncOptions{
+		OpenClose: &protocol.True,
+		Change:    &syncKind,
+		Save:      &protocol.SaveOptions{IncludeText: &protocol.True},
+	}
+	capabilities.CompletionProvider = &protocol.CompletionOptions{
+		TriggerCharacters: []string{`"`, "/"},
+	}
+	capabilities.RenameProvider = protocol.RenameOptions{PrepareProvider: &protocol.True}
+	capabilities.Workspace.FileOperations.WillRename = s.fileOperationFilters()
+	capabilities.Workspace.FileOperations.DidRename = s.fileOperationFilters()
+	capabilities.Workspace.FileOperations.DidDelete = s.fileOperationFilters()
+	capabilities.Workspace.WorkspaceFolders = &protocol.WorkspaceFoldersServerCapabilities{
+		Supported:           &protocol.True,
+		ChangeNotifications: &protocol.BoolOrString{Value: true},
+	}
+	capabilities.CodeActionProvider = protocol.CodeActionOptions{
+		CodeActionKinds: []protocol.CodeActionKind{
+			protocol.CodeActionKindQuickFix,
+			CodeActionKindCreateMissingNotes,
+		},
+	}
+	capabilities.SemanticTokensProvider = s.semanticTokensOptions()
+	if s.registersSemanticTokens() {
+		// Registered once initialized, so that a new query can replace the
+		// legend.
+		capabilities.SemanticTokensProvider = nil
+	}
+	capabilities.ExecuteCommandProvider = &protocol.ExecuteCommandOptions{
+		Commands: []string{
+			"graph", "open", "backlinks",
+			"neighbourhood", "path", "components", "strongly_connected",
+			"orphans", "leaves", "most_linked",
+		},
+	}
+
+	return initializeResult{
+		Capabilities: serverCapabilities{
+			ServerCapabilities: capabilities,
+			InlayHintProvider:  true,
+		},
+	}, nil
+}
 
-	// Root
-	rootUri, _ := url.Parse(*params.RootURI)
-	resolver.Configure(
-		rootUri.Path,
-		config.SelectRegex,
-		config.FileExtensions,
-		config.DefaultExtension,
-		config.TitleTemplate,
-		config.TitleSubstitutions,
-	)
-
-	// Cache File
+func (s *Server) initialized(
+	context *glsp.Context,
+	params *protocol.InitializedParams,
+) error {
+	log.Println("Client initialized.")
+	s.client = context
+
+	for _, v := range s.vaults {
+		if !v.progress.finished() {
+			s.reportScan(v)
+		}
+	}
+	if err := s.listen(); err != nil {
+		return err
+	}
+	if s.registersSemanticTokens() {
+		// Requests to the client must not block the handler.
+		go func(options protocol.SemanticTokensOptions) {
+			if err := s.registerSemanticTokens(options); err != nil {
+				log.Printf("Error registering semantic tokens: %v", err)
+			}
+		}(s.semanticTokensOptions())
+	}
+	s.watchFiles(context)
+	s.watchConfiguration(context)
+	return nil
+}
+
+func (s *Server) shutdown(context *glsp.Context) error {
+	s.flush()
+	return nil
+}
+
+func (s *Server) exit(context *glsp.Context) error {
+	// Only writes anything if the client exits without shutting down.
+	s.flush()
+	return nil
+}
+
+// cachePath returns the file the cache of a vault is dumped to. Every
+// configuration gets its own cache, keyed by a hash of the config.
+func cachePath(root string, config config.Config) (string, error) {
 	stateBaseDir, _ := getXDGStateHome("zeta")
 	hash := sha256.New()
 	b, err := json.Marshal(config)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	hash.Write([]byte(b))
 	configHash := hex.EncodeToString(hash.Sum(nil))
-	cacheDir := path.Join(stateBaseDir, url.PathEscape(rootUri.Path), configHash)
+	cacheDir := path.Join(stateBaseDir, url.PathEscape(root), configHash)
 	if err := os.MkdirAll(cacheDir, 0700); err != nil {
 		return "", fmt.Errorf("failed to create state directory: %w", err)
 	}
-	cacheFile := path.Join(cacheDir, "cache.json")
+	return path.Join(cacheDir, "cache.json"), nil
+}
 
-	// Restore from cache.
+// openCache restores the cache from its file, or starts a new one.
+func openCache(cacheFile string) cache.Cache {
 	dump, err := os.ReadFile(cacheFile)
 	if err != nil {
-		s.cache = cache.NewCache()
-	} else {
-		s.cache, err = cache.RestoreCache(dump)
-		if err != nil {
-			s.cache = cache.NewCache()
-		}
+		return cache.NewCache()
+	}
+	c, err := cache.RestoreCache(dump)
+	if err != nil {
+		log.Printf("Discarding cache %s: %v", cacheFile, err)
+		return cache.NewCache()
+	}
+	return c
+}
+
+// flush writes the caches of all vaults that changed since they were last
+// written.
+func (s *Server) flush() {
+	for _, v := range s.vaults {
+		v.flush()
 	}
+}
 
-	// Document Manager
-	s.manager = manager.NewDocumentManager()
+// flush writes the cache of the vault to its file, if it changed since the
+// last write.
+func (v *vault) flush() {
+	generation := v.cache.Generation()
+	if generation == v.flushed.Load() {
+		return
+	}
+	if err := writeCache(v.cache, v.cacheFile); err != nil {
+		log.Printf("Error during cache dump: %v", err)
+		return
+	}
+	v.flushed.Store(generation)
+}
 
-	// Parsers
-	parsers := parser.NewParserPool(10)
+// writeCache writes the cache to its file through a temporary file that
+// replaces it once complete, so a crash never leaves a truncated cache.
+func writeCache(c cache.Cache, cacheFile string) error {
+	log.Printf("Dumping cache to %s", cacheFile)
+	dump := c.Dump()
+	if dump == nil {
+		return fmt.Errorf("failed to encode cache")
+	}
+	f, err := os.CreateTemp(filepath.Dir(cacheFile), filepath.Base(cacheFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // fails once renamed
+	if _, err := f.Write(dump); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), cacheFile)
+}
+
+// scan indexes the notes of a vault that changed since they were saved to
+// its cache, and deletes the notes that no longer exist. Reconfiguring stops
+// the scan in favour of a new one.
+func (s *Server) scan(v *vault) {
+	ctx, cancel := context.WithCancel(context.Background())
+	v.stopScan = cancel
+	progress := newScanProgress()
+	v.progress = progress
 
-	// Note directory scanning + cache validation.
 	seenNotes := map[cache.Path]struct{}{}
-	skip := func(absolutepath string, info fs.FileInfo) bool {
-		note, err := resolver.Resolve(absolutepath)
-		if err != nil {
-			return true
+	skip := func(note resolver.Note, info fs.FileInfo) bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if ctx.Err() != nil || note.Vault != v.name {
+			return true // nested vaults are scanned on their own
 		}
+		progress.seen.Add(1)
 		seenNotes[note.CachePath] = struct{}{}
-		lastSeen := s.cache.GetSaveTime(note.CachePath)
 
-		hasNotChanged := lastSeen.After(info.ModTime())
-		if !hasNotChanged {
-			log.Printf("Note %s was was changed", absolutepath)
+		// Hashing is left to the workers, for files whose size or
+		// modification time changed. Unchanged files are still read once
+		// for the search index, but neither hashed nor parsed.
+		state, ok := v.cache.GetFileState(note.CachePath)
+		hasNotChanged := ok && state.Matches(info) && v.search.Has(note.CachePath)
+		if hasNotChanged {
+			progress.skipped.Add(1)
 		}
 		return hasNotChanged
 	}
-	now := time.Now()
 
-	callback := func(absolutepath string, document []byte) {
-		note, err := resolver.Resolve(absolutepath)
-		if err != nil {
-			log.Printf("Unexpected error resolving %v", err)
+	// Notes are parsed concurrently, but committed to the cache one by one.
+	parse := func(note resolver.Note, info fs.FileInfo, document []byte) (parsedNote, error) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if ctx.Err() != nil {
+			return parsedNote{}, ctx.Err()
 		}
-		nodes, err := parsers.ParseAndQuery(document, []byte(s.config.Query))
-		if err != nil {
-			log.Printf("Unexpected error parsing %v", err)
+		if old, ok := v.cache.GetFileState(note.CachePath); ok && old.Matches(info) {
+			return parsedNote{unchanged: true, indexOnly: true, content: search.Analyze(document)}, nil
 		}
-		links, meta := resolver.ExtractLinksAndMeta(note, nodes, document)
-		err = s.cache.SaveNote(note.CachePath, links, meta, now)
+		state := cache.NewFileState(document, info.ModTime())
+		parsed, err := s.parseChanged(v, note, document, state)
 		if err != nil {
 			log.Println(err)
 		}
+		return parsed, err
+	}
+	commit := func(note resolver.Note, parsed parsedNote) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if ctx.Err() != nil {
+			return
+		}
+		if err := commitParsed(v, note, parsed); err != nil {
+			log.Println(err)
+		}
+		if parsed.unchanged {
+			progress.skipped.Add(1)
+		} else {
+			log.Printf("Note %s was changed", note.AbsolutePath)
+			progress.parsed.Add(1)
+		}
 	}
+	workers := s.config.ScanWorkers
 
+	// Before initialized, the client cannot take progress yet; initialized
+	// reports the scans started so far.
+	s.reportScan(v)
 	go func() {
-		scanner.Scan(rootUri.Path, skip, callback)
-		notes := s.cache.GetPaths()
+		defer close(progress.done)
+		scanner.Scan(v.resolver, workers, skip, parse, commit)
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if ctx.Err() != nil {
+			return
+		}
+		notes := v.cache.GetPaths()
 		for _, note := range notes {
 			if _, ok := seenNotes[note]; !ok {
-				s.cache.DeleteNote(note)
+				v.cache.DeleteNote(note)
+				v.search.Delete(note)
 			}
 		}
 	}()
+}
 
-	// Start cache dump routine.
-	ticker := time.NewTicker(5 * time.Minute)
-	go func() {
-		for range ticker.C {
-			log.Printf("Dumping cache to %s", cacheFile)
-			dump := s.cache.Dump()
-			err := os.WriteFile(cacheFile, dump, 0644)
+// listen subscribes the code lens refresh and the graph viewer to the caches
+// of all vaults, replacing earlier subscriptions.
+func (s *Server) listen() error {
+	if s.stopListen != nil {
+		s.stopListen()
+	}
+	s.listeners, s.stopListen = context.WithCancel(context.Background())
+
+	workspace := s.capabilities.Workspace
+	if workspace != nil && workspace.CodeLens != nil &&
+		workspace.CodeLens.RefreshSupport != nil && *workspace.CodeLens.RefreshSupport {
+		var managers []*manager.DocumentManager
+		for _, v := range s.vaults {
+			managers = append(managers, v.manager)
+		}
+		for _, v := range s.vaults {
+			events, err := v.cache.Subscribe(s.listeners, cache.SubscribeOptions{})
 			if err != nil {
-				log.Printf("Error during cache dump: %v", err)
+				return err
 			}
+			go s.refreshCodeLenses(v.resolver, managers, events)
 		}
-	}()
-
-	syncKind := protocol.TextDocumentSyncKindIncremental
-
-	capabilities := s.handler.CreateServerCapabilities()
-	capabilities.TextDocumentSync = &protocol.TextDocumentSyncOptions{
-		OpenClose: &protocol.True,
-		Change:    &syncKind,
-		Save:      &protocol.SaveOptions{IncludeText: &protocol.True},
 	}
-
-	return protocol.InitializeResult{
-		Capabilities: capabilities,
-	}, nil
-}
-
-func (s *Server) initialized(
-	context *glsp.Context,
-	params *protocol.InitializedParams,
-) error {
-	log.Println("Client initialized.")
-	return nil
-}
-
-func (s *Server) shutdown(context *glsp.Context) error {
+	if s.config.OrphanHints {
+		for _, v := range s.vaults {
+			events, err := v.cache.Subscribe(s.listeners, cache.SubscribeOptions{})
+			if err != nil {
+				return err
+			}
+			go s.watchOrphans(events)
+		}
+	} else {
+		go s.refreshOrphanHints() // clears the hints shown so far
+	}
+	if len(s.graphAddr) > 0 {
+		return s.listenGraph()
+	}
 	return nil
 }
 
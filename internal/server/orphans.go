@@ -0,0 +1,141 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+	"zeta/internal/cache"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// orphanRefreshDelay bundles bursts of graph events into a single update of
+// the orphan hints.
+const orphanRefreshDelay = time.Second
+
+// orphanNote is a note in the orphan report.
+type orphanNote struct {
+	protocol.SymbolInformation
+	Reasons []string `json:"reasons"`
+}
+
+// orphans returns the notes without backlinks, without links, or with links
+// to missing notes only. The optional first argument keeps only the notes
+// with that reason.
+func (s *Server) orphans(args []any) (any, error) {
+	var only string
+	if len(args) > 0 && args[0] != nil {
+		var err error
+		if only, err = stringArg("orphans", args, 0, "reason"); err != nil {
+			return nil, err
+		}
+		if !slices.Contains([]string{cache.ReasonNoBacklinks, cache.ReasonNoLinks, cache.ReasonOnlyPlaceholders}, only) {
+			return nil, fmt.Errorf("orphans: unknown reason %q", only)
+		}
+	}
+
+	t := s.topology()
+	result := []orphanNote{} // empty, not nil
+	for _, o := range t.OrphanReport() {
+		reasons := o.Reasons()
+		if only != "" && !slices.Contains(reasons, only) {
+			continue
+		}
+		result = append(result, orphanNote{SymbolInformation: t.symbol(s, o.Path), Reasons: reasons})
+	}
+	return result, nil
+}
+
+// watchOrphans updates the orphan hints after events of a vault.
+func (s *Server) watchOrphans(events <-chan cache.Event) {
+	var pending atomic.Bool
+	for range events {
+		if pending.Swap(true) {
+			continue
+		}
+		time.AfterFunc(orphanRefreshDelay, func() {
+			// A scan sends events all along, which a single refresh after
+			// it covers. Events from then on call for another one.
+			s.waitForScans()
+			pending.Store(false)
+			s.refreshOrphanHints()
+		})
+	}
+}
+
+// waitForScans waits for the scans of all vaults. Until they are done, every
+// note would look like an orphan.
+func (s *Server) waitForScans() {
+	s.mu.RLock()
+	var scans []chan struct{}
+	for _, v := range s.vaults {
+		if v.progress != nil {
+			scans = append(scans, v.progress.done)
+		}
+	}
+	s.mu.RUnlock()
+	for _, done := range scans {
+		<-done
+	}
+}
+
+// refreshOrphanHints publishes the diagnostics of the notes that became or
+// ceased to be orphans.
+func (s *Server) refreshOrphanHints() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	orphaned := map[string]bool{}
+	if s.config.OrphanHints {
+		t := s.topology()
+		for _, o := range t.OrphanReport() {
+			if note, ok := t.notes[o.Path]; ok && o.NoBacklinks {
+				orphaned[note.URI] = true
+			}
+		}
+	}
+
+	s.orphanMu.Lock()
+	var changed []string
+	for uri := range orphaned {
+		if !s.orphaned[uri] {
+			changed = append(changed, uri)
+		}
+	}
+	for uri := range s.orphaned {
+		if !orphaned[uri] {
+			changed = append(changed, uri)
+		}
+	}
+	s.orphaned = orphaned
+	s.orphanMu.Unlock()
+
+	for _, uri := range changed {
+		v, note, err := s.vaultOf(uri)
+		if err != nil {
+			continue
+		}
+		var links []cache.Link
+		if v.manager.IsOpen(note.URI) {
+			links, _ = v.cache.GetForwardLinks(note.CachePath)
+		}
+		publishDiagnostics(s.client, note.URI, s.noteDiagnostics(v, note.URI, links))
+	}
+}
+
+// orphanHint returns a hint at the top of a note if no other note links to
+// it and orphan hints are enabled.
+func (s *Server) orphanHint(uri string) []protocol.Diagnostic {
+	s.orphanMu.Lock()
+	defer s.orphanMu.Unlock()
+	if !s.orphaned[uri] {
+		return nil
+	}
+	hint := protocol.DiagnosticSeverityHint
+	return []protocol.Diagnostic{
+		{
+			Severity: &hint,
+			Message:  "No note links here",
+		},
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// scanTimeout is how long requests that need the whole index wait for the
+// scans to finish before answering from a partial index.
+const scanTimeout = 3 * time.Second
+
+// indexRequests are the requests whose answer depends on every note.
+var indexRequests = map[string]bool{
+	protocol.MethodTextDocumentReferences:     true,
+	protocol.MethodTextDocumentCompletion:     true,
+	protocol.MethodTextDocumentCodeLens:       true,
+	protocol.MethodTextDocumentRename:         true,
+	protocol.MethodCallHierarchyIncomingCalls: true,
+	protocol.MethodWorkspaceSymbol:            true,
+	protocol.MethodWorkspaceWillRenameFiles:   true,
+	MethodSearch:                              true,
+}
+
+// indexCommands are the commands whose answer depends on every note.
+var indexCommands = map[string]bool{
+	"backlinks":          true,
+	"neighbourhood":      true,
+	"path":               true,
+	"components":         true,
+	"strongly_connected": true,
+	"orphans":            true,
+	"leaves":             true,
+	"most_linked":        true,
+}
+
+// scanProgress counts the notes a scan has handled so far.
+type scanProgress struct {
+	seen    atomic.Int64  // notes found
+	skipped atomic.Int64  // notes unchanged since they were cached
+	parsed  atomic.Int64  // notes indexed
+	done    chan struct{} // closed when the scan finished or was stopped
+}
+
+func newScanProgress() *scanProgress {
+	return &scanProgress{done: make(chan struct{})}
+}
+
+func (p *scanProgress) message() string {
+	return fmt.Sprintf(
+		"%d notes, %d unchanged, %d parsed",
+		p.seen.Load(), p.skipped.Load(), p.parsed.Load(),
+	)
+}
+
+// finished reports whether the scan is over.
+func (p *scanProgress) finished() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// reportScan shows the progress of the scan of a vault in the client, if it
+// supports server initiated progress.
+func (s *Server) reportScan(v *vault) {
+	window := s.capabilities.Window
+	if s.client == nil || window == nil || window.WorkDoneProgress == nil || !*window.WorkDoneProgress {
+		return
+	}
+	client, p := s.client, v.progress
+	token := protocol.ProgressToken{Value: fmt.Sprintf("zeta/scan/%d", s.progressID.Add(1))}
+	title := "Indexing " + v.name
+
+	// Requests to the client must not block the handler.
+	go func() {
+		client.Call(
+			string(protocol.ServerWindowWorkDoneProgressCreate),
+			protocol.WorkDoneProgressCreateParams{Token: token},
+			nil,
+		)
+		progress := func(value any) {
+			client.Notify(string(protocol.MethodProgress), protocol.ProgressParams{Token: token, Value: value})
+		}
+
+		message := p.message()
+		progress(protocol.WorkDoneProgressBegin{Kind: "begin", Title: title, Message: &message})
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				message := p.message()
+				progress(protocol.WorkDoneProgressEnd{Kind: "end", Message: &message})
+				return
+			case <-ticker.C:
+				message := p.message()
+				progress(protocol.WorkDoneProgressReport{Kind: "report", Message: &message})
+			}
+		}
+	}()
+}
+
+// needsIndex reports whether the answer to a request depends on every note.
+func needsIndex(req *jsonrpc2.Request) bool {
+	if req.Notif {
+		return false
+	}
+	if req.Method != protocol.MethodWorkspaceExecuteCommand {
+		return indexRequests[req.Method]
+	}
+	var params protocol.ExecuteCommandParams
+	if req.Params == nil || json.Unmarshal(*req.Params, &params) != nil {
+		return false
+	}
+	return indexCommands[params.Command]
+}
+
+// runningScans returns the scans of the vaults that are not done yet.
+func (s *Server) runningScans() []*scanProgress {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var running []*scanProgress
+	for _, v := range s.vaults {
+		if !v.progress.finished() {
+			running = append(running, v.progress)
+		}
+	}
+	return running
+}
+
+// awaitScans waits up to scanTimeout for the scans to finish.
+func awaitScans(scans []*scanProgress) {
+	timeout := time.After(scanTimeout)
+	for _, p := range scans {
+		select {
+		case <-p.done:
+		case <-timeout:
+			log.Printf("Scans still running, answering from a partial index")
+			return
+		}
+	}
+}
+
+// indexed reports whether the scans of all vaults are done. The caller
+// holds s.mu.
+func (s *Server) indexed() bool {
+	for _, v := range s.vaults {
+		if !v.progress.finished() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"fmt"
+	"zeta/internal/cache"
+	"zeta/internal/resolver"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// noteHop is a note in a neighbourhood.
+type noteHop struct {
+	protocol.SymbolInformation
+	Distance int `json:"distance"`
+}
+
+// rankedNote is a note in a ranking.
+type rankedNote struct {
+	protocol.SymbolInformation
+	Score float64 `json:"score"`
+}
+
+// topology is the graph of all vaults in one, keyed by qualified path.
+type topology struct {
+	*cache.Topology
+	notes map[cache.Path]resolver.Note
+}
+
+// topology merges the caches of all vaults. Links across vaults end at the
+// note in the other vault, not at a placeholder.
+func (s *Server) topology() topology {
+	t := topology{Topology: cache.NewTopology(), notes: map[cache.Path]resolver.Note{}}
+	for _, v := range s.vaults {
+		t.Merge(v.cache.Topology(), func(path cache.Path) cache.Path {
+			note, err := v.resolver.Resolve(path)
+			if err != nil {
+				return resolver.Qualify(v.name, path)
+			}
+			k := resolver.Qualify(note.Vault, note.RelativePath)
+			if _, ok := t.notes[k]; !ok || note.Vault == v.name {
+				t.notes[k] = note
+			}
+			return k
+		})
+	}
+	return t
+}
+
+// queryKey returns the path of the note at uri in the topology.
+func (s *Server) queryKey(uri string) (cache.Path, error) {
+	_, note, err := s.vaultOf(uri)
+	if err != nil {
+		return "", err
+	}
+	return resolver.Qualify(note.Vault, note.RelativePath), nil
+}
+
+// symbol describes the note at key like a workspace symbol.
+func (t topology) symbol(s *Server, key cache.Path) protocol.SymbolInformation {
+	note, ok := t.notes[key]
+	if !ok {
+		return protocol.SymbolInformation{Name: key, Kind: protocol.SymbolKindFile}
+	}
+	return protocol.SymbolInformation{
+		Name:          s.title(note),
+		Kind:          protocol.SymbolKindFile,
+		Location:      protocol.Location{URI: note.URI},
+		ContainerName: &note.Vault,
+	}
+}
+
+func (t topology) symbols(s *Server, keys []cache.Path) []protocol.SymbolInformation {
+	symbols := []protocol.SymbolInformation{} // empty, not nil
+	for _, k := range keys {
+		symbols = append(symbols, t.symbol(s, k))
+	}
+	return symbols
+}
+
+func (t topology) groups(s *Server, groups [][]cache.Path) [][]protocol.SymbolInformation {
+	result := [][]protocol.SymbolInformation{} // empty, not nil
+	for _, g := range groups {
+		result = append(result, t.symbols(s, g))
+	}
+	return result
+}
+
+// neighbourhood returns the notes within a number of links (the second
+// argument, 1 by default) of the note given as the first argument, nearest
+// first. The optional third argument is the direction of the links.
+func (s *Server) neighbourhood(args []any) (any, error) {
+	uri, err := stringArg("neighbourhood", args, 0, "document uri")
+	if err != nil {
+		return nil, err
+	}
+	hops, err := intArg("neighbourhood", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := directionArg("neighbourhood", args, 2, cache.Both)
+	if err != nil {
+		return nil, err
+	}
+
+	t := s.topology()
+	k, err := s.queryKey(uri)
+	if err != nil {
+		return nil, err
+	}
+	found, err := t.Neighbourhood(k, hops, dir)
+	if err != nil {
+		return nil, err
+	}
+	result := []noteHop{} // empty, not nil
+	for _, h := range found {
+		result = append(result, noteHop{SymbolInformation: t.symbol(s, h.Path), Distance: h.Distance})
+	}
+	return result, nil
+}
+
+// shortestPath returns the notes on a shortest path from the note given as
+// the first argument to the one given as the second. The optional third
+// argument is the direction of the links, outgoing by default.
+func (s *Server) shortestPath(args []any) (any, error) {
+	from, err := stringArg("path", args, 0, "document uri")
+	if err != nil {
+		return nil, err
+	}
+	to, err := stringArg("path", args, 1, "document uri")
+	if err != nil {
+		return nil, err
+	}
+	dir, err := directionArg("path", args, 2, cache.Outgoing)
+	if err != nil {
+		return nil, err
+	}
+
+	t := s.topology()
+	fromKey, err := s.queryKey(from)
+	if err != nil {
+		return nil, err
+	}
+	toKey, err := s.queryKey(to)
+	if err != nil {
+		return nil, err
+	}
+	path, err := t.ShortestPath(fromKey, toKey, dir)
+	if err != nil {
+		return nil, err
+	}
+	return t.symbols(s, path), nil
+}
+
+// components returns the groups of notes connected by links, largest first.
+func (s *Server) components(args []any) (any, error) {
+	t := s.topology()
+	return t.groups(s, t.Components()), nil
+}
+
+// stronglyConnected returns the groups of notes that link to each other in
+// cycles, largest first.
+func (s *Server) stronglyConnected(args []any) (any, error) {
+	t := s.topology()
+	return t.groups(s, t.StronglyConnected()), nil
+}
+
+// leaves returns the notes that are linked to but link nowhere.
+func (s *Server) leaves(args []any) (any, error) {
+	t := s.topology()
+	return t.symbols(s, t.Leaves()), nil
+}
+
+// mostLinked ranks the notes by "in_degree" or "pagerank" (the first
+// argument, in_degree by default) and returns the top ones (the second
+// argument, 20 by default).
+func (s *Server) mostLinked(args []any) (any, error) {
+	by := "in_degree"
+	if len(args) > 0 {
+		var err error
+		if by, err = stringArg("most_linked", args, 0, "ranking"); err != nil {
+			return nil, err
+		}
+	}
+	limit, err := intArg("most_linked", args, 1, 20)
+	if err != nil {
+		return nil, err
+	}
+
+	t := s.topology()
+	var ranking []cache.Ranked
+	switch by {
+	case "in_degree":
+		ranking = t.InDegree()
+	case "pagerank":
+		ranking = t.PageRank()
+	default:
+		return nil, fmt.Errorf("most_linked: unknown ranking %q", by)
+	}
+	result := []rankedNote{} // empty, not nil
+	for _, r := range ranking[:min(limit, len(ranking))] {
+		result = append(result, rankedNote{SymbolInformation: t.symbol(s, r.Path), Score: r.Score})
+	}
+	return result, nil
+}
+
+// stringArg returns the i-th argument of a command, which must be a string.
+func stringArg(command string, args []any, i int, what string) (string, error) {
+	if len(args) <= i {
+		return "", fmt.Errorf("%s: missing %s", command, what)
+	}
+	str, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("%s: invalid %s %v", command, what, args[i])
+	}
+	return str, nil
+}
+
+// intArg returns the optional i-th argument of a command, which must be a
+// whole number.
+func intArg(command string, args []any, i int, def int) (int, error) {
+	if len(args) <= i || args[i] == nil {
+		return def, nil
+	}
+	n, ok := args[i].(float64) // JSON numbers
+	if !ok || n != float64(int(n)) || n < 0 {
+		return 0, fmt.Errorf("%s: invalid number %v", command, args[i])
+	}
+	return int(n), nil
+}
+
+// directionArg returns the optional i-th argument of a command, which must
+// be "both", "outgoing" or "incoming".
+func directionArg(command string, args []any, i int, def cache.Direction) (cache.Direction, error) {
+	if len(args) <= i || args[i] == nil {
+		return def, nil
+	}
+	switch args[i] {
+	case "both":
+		return cache.Both, nil
+	case "outgoing":
+		return cache.Outgoing, nil
+	case "incoming":
+		return cache.Incoming, nil
+	}
+	return 0, fmt.Errorf("%s: invalid direction %v", command, args[i])
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"zeta/internal/resolver"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func (s *Server) textDocumentPrepareRename(
+	context *glsp.Context,
+	params *protocol.PrepareRenameParams,
+) (any, error) {
+	subject, r, err := s.noteAt(params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.RangeWithPlaceholder{Range: r, Placeholder: subject.RelativePath}, nil
+}
+
+func (s *Server) textDocumentRename(
+	context *glsp.Context,
+	params *protocol.RenameParams,
+) (*protocol.WorkspaceEdit, error) {
+	// Renaming from a partial index would miss links.
+	if !s.indexed() {
+		return nil, fmt.Errorf("notes are still being indexed, try again shortly")
+	}
+	from, _, err := s.noteAt(params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, err
+	}
+
+	newName := params.NewName
+	if filepath.Ext(newName) == "" {
+		newName += s.config.DefaultExtension
+	}
+	v, _, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	to, err := v.resolver.Resolve(newName)
+	if err != nil {
+		return nil, err
+	}
+	if to.AbsolutePath == from.AbsolutePath {
+		return nil, nil
+	}
+	if s.noteExists(to) {
+		return nil, fmt.Errorf("note %s already exists", to.CachePath)
+	}
+
+	return s.renameNote(from, to)
+}
+
+// renameNote returns the edit that moves a note and keeps all references to
+// it intact.
+func (s *Server) renameNote(from resolver.Note, to resolver.Note) (*protocol.WorkspaceEdit, error) {
+	edits, err := s.renameEdits(map[string]resolver.Note{from.AbsolutePath: to})
+	if err != nil {
+		return nil, err
+	}
+	// Placeholders have no file to rename.
+	if !s.noteExists(from) {
+		return s.workspaceEdit(edits), nil
+	}
+	if !s.supportsResourceOperation(protocol.ResourceOperationKindRename) {
+		return nil, fmt.Errorf("the editor cannot rename %s, rename the file instead", from.RelativePath)
+	}
+	changes := append(documentChanges(edits), protocol.RenameFile{
+		Kind:   "rename",
+		OldURI: from.URI,
+		NewURI: to.URI,
+	})
+	return &protocol.WorkspaceEdit{DocumentChanges: changes}, nil
+}
+
+// noteAt returns the note a position refers to: the
+// target of the link under the cursor, or else the document itself.
+func (s *Server) noteAt(
+	uri protocol.DocumentUri,
+	position protocol.Position,
+) (resolver.Note, protocol.Range, error) {
+	target, r, err := s.linkAt(uri, position)
+	if err != nil {
+		return resolver.Note{}, protocol.Range{}, err
+	}
+	if target != nil {
+		return *target, *r, nil
+	}
+	_, note, err := s.vaultOf(uri)
+	return note, protocol.Range{Start: position, End: position}, err
+}
+
+// renameEdits computes the text edits needed to keep all references intact
+// when moving notes, given as a map from their old absolute path to their new
+// note. These are the backlinks of the moved notes and, if a note changes
+// directory or vault, its own links.
+func (s *Server) renameEdits(
+	moves map[string]resolver.Note,
+) (map[protocol.DocumentUri][]protocol.TextEdit, error) {
+	edits := map[protocol.DocumentUri][]protocol.TextEdit{}
+
+	for path, to := range moves {
+		v, from, err := s.vaultOf(path)
+		if err != nil {
+			continue
+		}
+		backlinks, err := s.incomingLinks(from)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range backlinks {
+			source, err := l.vault.resolver.Resolve(l.Source)
+			if err != nil {
+				continue
+			}
+			doc, err := s.readDocument(source)
+			if err != nil {
+				continue
+			}
+			// Sources that are moved as well are rewritten from their new location.
+			newSource := source
+			if moved, ok := moves[source.AbsolutePath]; ok {
+				newSource = moved
+			}
+			for _, r := range l.Ranges {
+				if edit, ok := s.rewriteReference(l.vault.resolver, doc, r, newSource, to, false); ok {
+					edits[source.URI] = append(edits[source.URI], edit)
+				}
+			}
+		}
+
+		sameVault := from.Vault == to.Vault
+		if sameVault && filepath.Dir(from.AbsolutePath) == filepath.Dir(to.AbsolutePath) {
+			continue
+		}
+		forward, err := v.cache.GetForwardLinks(from.CachePath)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := s.readDocument(from)
+		if err != nil {
+			continue
+		}
+		for _, l := range forward {
+			target, err := v.resolver.Resolve(l.Target)
+			if err != nil {
+				continue
+			}
+			if _, ok := moves[target.AbsolutePath]; ok {
+				continue // already handled as a backlink
+			}
+			for _, r := range l.Ranges {
+				// Root references only change when the note leaves its vault.
+				if edit, ok := s.rewriteReference(v.resolver, doc, r, to, target, sameVault); ok {
+					edits[from.URI] = append(edits[from.URI], edit)
+				}
+			}
+		}
+	}
+	return edits, nil
+}
+
+// rewriteReference rewrites the reference at r to point from source to
+// target, keeping its style: relative or root, with or without extension and
+// wrapped as by the select_regex of rs.
+func (s *Server) rewriteReference(
+	rs *resolver.Resolver,
+	doc []byte,
+	r protocol.Range,
+	source resolver.Note,
+	target resolver.Note,
+	onlyRelative bool,
+) (protocol.TextEdit, bool) {
+	from, to := r.IndexesIn(string(doc))
+	if from < 0 || to > len(doc) || from > to {
+		return protocol.TextEdit{}, false
+	}
+	raw := string(doc[from:to])
+	start, end, ok := rs.SelectIndex(raw)
+	if !ok {
+		return protocol.TextEdit{}, false
+	}
+	selected := raw[start:end]
+	relative := resolver.IsRelativeReference(selected)
+	if onlyRelative && !relative {
+		return protocol.TextEdit{}, false
+	}
+	withExtension := filepath.Ext(selected) != ""
+	reference := rs.Reference(source, target, relative, withExtension)
+	if reference == selected {
+		return protocol.TextEdit{}, false
+	}
+	return protocol.TextEdit{
+		Range:   r,
+		NewText: raw[:start] + reference + raw[end:],
+	}, true
+}
+
+// workspaceEdit returns the text edits per document as a WorkspaceEdit, with
+// documentChanges if the client supports them.
+func (s *Server) workspaceEdit(edits map[protocol.DocumentUri][]protocol.TextEdit) *protocol.WorkspaceEdit {
+	workspace := s.capabilities.Workspace
+	if workspace == nil || workspace.WorkspaceEdit == nil ||
+		workspace.WorkspaceEdit.DocumentChanges == nil || !*workspace.WorkspaceEdit.DocumentChanges {
+		return &protocol.WorkspaceEdit{Changes: edits}
+	}
+	return &protocol.WorkspaceEdit{DocumentChanges: documentChanges(edits)}
+}
+
+// supportsResourceOperation reports whether the client creates, renames or
+// deletes files as part of a WorkspaceEdit.
+func (s *Server) supportsResourceOperation(kind protocol.ResourceOperationKind) bool {
+	workspace := s.capabilities.Workspace
+	if workspace == nil || workspace.WorkspaceEdit == nil {
+		return false
+	}
+	return slices.Contains(workspace.WorkspaceEdit.ResourceOperations, kind)
+}
+
+// documentChanges converts text edits per document into the (ordered)
+// documentChanges of a WorkspaceEdit.
+func documentChanges(edits map[protocol.DocumentUri][]protocol.TextEdit) []any {
+	uris := make([]protocol.DocumentUri, 0, len(edits))
+	for uri := range edits {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	changes := []any{}
+	for _, uri := range uris {
+		textEdits := make([]any, 0, len(edits[uri]))
+		for _, e := range edits[uri] {
+			textEdits = append(textEdits, e)
+		}
+		changes = append(changes, protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			},
+			Edits: textEdits,
+		})
+	}
+	return changes
+}
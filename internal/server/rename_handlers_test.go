@@ -0,0 +1,199 @@
+package server
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"zeta/internal/cache"
+	"zeta/internal/resolver"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestRenameDocumentChanges(t *testing.T) {
+	s, v := newTestServer(t,
+		map[string]string{
+			"a.typ":     `#link("b") and #link("b.typ")`,
+			"sub/c.typ": `#link("../b")`,
+			"b.typ":     `#link("./sub/c")`,
+		},
+		map[string][]cache.Link{
+			"a.typ": {{
+				Source: "a.typ",
+				Target: "b.typ",
+				Ranges: []protocol.Range{
+					{Start: protocol.Position{Character: 6}, End: protocol.Position{Character: 9}},
+					{Start: protocol.Position{Character: 21}, End: protocol.Position{Character: 28}},
+				},
+			}},
+			"sub/c.typ": {link("sub/c.typ", "b.typ", 6, 12)},
+			"b.typ":     {link("b.typ", "sub/c.typ", 6, 15)},
+		},
+	)
+	from, err := v.resolver.Resolve("b.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := v.resolver.Resolve("d/e.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edits, err := s.renameEdits(map[string]resolver.Note{from.AbsolutePath: to})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uri := func(path string) protocol.DocumentUri {
+		note, err := v.resolver.Resolve(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note.URI
+	}
+	edit := func(start, end uint32, text string) any {
+		return protocol.TextEdit{
+			Range: protocol.Range{
+				Start: protocol.Position{Character: start},
+				End:   protocol.Position{Character: end},
+			},
+			NewText: text,
+		}
+	}
+	textDocumentEdit := func(path string, edits ...any) protocol.TextDocumentEdit {
+		return protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri(path)},
+			},
+			Edits: edits,
+		}
+	}
+
+	// The backlinks keep their style, and the moved note's own relative
+	// link follows it into its new directory. Documents are in order.
+	want := []protocol.TextDocumentEdit{
+		textDocumentEdit("a.typ", edit(6, 9, `"d/e"`), edit(21, 28, `"d/e.typ"`)),
+		textDocumentEdit("b.typ", edit(6, 15, `"../sub/c"`)),
+		textDocumentEdit("sub/c.typ", edit(6, 12, `"../d/e"`)),
+	}
+	changes := documentChanges(edits)
+	if len(changes) != len(want) {
+		t.Fatalf("got %d document changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, c := range changes {
+		if !reflect.DeepEqual(c, want[i]) {
+			t.Errorf("change %d:\n got %+v\nwant %+v", i, c, want[i])
+		}
+	}
+}
+
+func TestWillRenameDirectory(t *testing.T) {
+	s, v := newTestServer(t,
+		map[string]string{
+			"a.typ":     `#link("sub/c")`,
+			"sub/c.typ": `#link("../a")`,
+		},
+		map[string][]cache.Link{
+			"a.typ":     {link("a.typ", "sub/c.typ", 6, 13)},
+			"sub/c.typ": {link("sub/c.typ", "a.typ", 6, 12)},
+		},
+	)
+	s.capabilities = workspaceEditCapabilities()
+	a, _ := v.resolver.Resolve("a.typ")
+	params := &protocol.RenameFilesParams{
+		Files: []protocol.FileRename{{
+			OldURI: "file://" + filepath.Join(v.root, "sub"),
+			NewURI: "file://" + filepath.Join(v.root, "other"),
+		}},
+	}
+
+	// Edits from a partial index would miss links.
+	done := v.progress
+	v.progress = newScanProgress()
+	if _, err := s.workspaceWillRenameFiles(nil, params); err == nil {
+		t.Error("renamed files during a scan")
+	}
+	v.progress = done
+
+	edit, err := s.workspaceWillRenameFiles(nil, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the backlink changes: the moved note stays as deep as it was.
+	want := []any{protocol.TextDocumentEdit{
+		TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: a.URI},
+		},
+		Edits: []any{protocol.TextEdit{
+			Range: protocol.Range{
+				Start: protocol.Position{Character: 6},
+				End:   protocol.Position{Character: 13},
+			},
+			NewText: `"other/c"`,
+		}},
+	}}
+	if edit == nil || !reflect.DeepEqual(edit.DocumentChanges, want) {
+		t.Errorf("got %+v, want document changes %+v", edit, want)
+	}
+	// The cache follows only once the files are renamed.
+	if !v.cache.NoteExists("sub/c.typ") {
+		t.Errorf("moved sub/c.typ before the rename")
+	}
+}
+
+func TestRenameNoteCapabilities(t *testing.T) {
+	s, v := newTestServer(t,
+		map[string]string{"a.typ": `#link("b") #link("c")`, "b.typ": `= B`},
+		map[string][]cache.Link{"a.typ": {
+			link("a.typ", "b.typ", 6, 9),
+			link("a.typ", "c.typ", 17, 20),
+		}},
+	)
+	resolve := func(path string) resolver.Note {
+		note, err := v.resolver.Resolve(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note
+	}
+	a, b, c, d := resolve("a.typ"), resolve("b.typ"), resolve("c.typ"), resolve("d.typ")
+	edit := func(start, end uint32) []protocol.TextEdit {
+		return []protocol.TextEdit{{
+			Range: protocol.Range{
+				Start: protocol.Position{Character: start},
+				End:   protocol.Position{Character: end},
+			},
+			NewText: `"d"`,
+		}}
+	}
+
+	// Without documentChanges, only the links of placeholders can move.
+	if _, err := s.renameNote(b, d); err == nil {
+		t.Error("renamed b.typ without renaming its file")
+	}
+	got, err := s.renameNote(c, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[protocol.DocumentUri][]protocol.TextEdit{a.URI: edit(17, 20)}
+	if !reflect.DeepEqual(got.Changes, want) || len(got.DocumentChanges) != 0 {
+		t.Errorf("placeholder: got %+v, want changes %+v", got, want)
+	}
+
+	// Text edits alone would break the links to a note, so the file moves
+	// with them.
+	s.capabilities = workspaceEditCapabilities()
+	if _, err := s.renameNote(b, d); err == nil {
+		t.Error("renamed b.typ without renaming its file")
+	}
+	s.capabilities = workspaceEditCapabilities(protocol.ResourceOperationKindRename)
+	got, err = s.renameNote(b, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := documentChanges(map[protocol.DocumentUri][]protocol.TextEdit{a.URI: edit(6, 9)})
+	changes = append(changes, protocol.RenameFile{Kind: "rename", OldURI: b.URI, NewURI: d.URI})
+	if !reflect.DeepEqual(got.DocumentChanges, changes) {
+		t.Errorf("got %+v, want document changes %+v", got.DocumentChanges, changes)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"zeta/internal/search"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const MethodSearch = "zeta/search"
+
+// Defaults of SearchParams.
+const (
+	searchLimit    = 20
+	searchSnippets = 3
+)
+
+type SearchParams struct {
+	Query    string `json:"query"`
+	Limit    int    `json:"limit,omitempty"`
+	Snippets int    `json:"snippets,omitempty"` // per note
+}
+
+// SearchResult is a note matching a search, with the lines that match.
+type SearchResult struct {
+	protocol.SymbolInformation
+	Score    float64          `json:"score"`
+	Snippets []search.Snippet `json:"snippets"`
+}
+
+// zetaSearch searches the contents of the notes of all vaults.
+func (s *Server) zetaSearch(
+	context *glsp.Context,
+	params *SearchParams,
+) (any, error) {
+	if params.Limit < 0 || params.Snippets < 0 {
+		return nil, fmt.Errorf("%s: limit and snippets must not be negative", MethodSearch)
+	}
+	limit := cmp.Or(params.Limit, searchLimit)
+	snippets := cmp.Or(params.Snippets, searchSnippets)
+
+	type vaultHit struct {
+		search.Hit
+		vault *vault
+	}
+	var hits []vaultHit
+	for _, v := range s.vaults {
+		for _, h := range v.search.Search(params.Query, limit) {
+			hits = append(hits, vaultHit{h, v})
+		}
+	}
+	slices.SortFunc(hits, func(a, b vaultHit) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+
+	results := []SearchResult{} // empty, not nil
+	for _, h := range hits[:min(limit, len(hits))] {
+		note, err := h.vault.resolver.Resolve(h.Path)
+		if err != nil {
+			continue
+		}
+		matches := []search.Snippet{} // empty, not nil
+		if document, err := s.readDocument(note); err == nil {
+			matches = search.Snippets(document, params.Query, snippets)
+		}
+		results = append(results, SearchResult{
+			SymbolInformation: protocol.SymbolInformation{
+				Name:          s.title(note),
+				Kind:          protocol.SymbolKindFile,
+				Location:      protocol.Location{URI: note.URI},
+				ContainerName: &note.Vault,
+			},
+			Score:    h.Score,
+			Snippets: matches,
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	notes := map[string]string{}
+	for i := range searchLimit + 5 {
+		notes[fmt.Sprintf("%02d.typ", i)] = strings.Repeat("zeta\n\n", i+1)
+	}
+	notes["other.typ"] = "nothing to see"
+	s, _ := newTestServer(t, notes, nil)
+
+	search := func(params SearchParams) []SearchResult {
+		t.Helper()
+		result, err := s.zetaSearch(nil, &params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.([]SearchResult)
+	}
+
+	results := search(SearchParams{Query: "zeta"})
+	if len(results) != searchLimit {
+		t.Errorf("got %d results, want the default of %d", len(results), searchLimit)
+	}
+	for _, r := range results {
+		if len(r.Snippets) != searchSnippets {
+			t.Errorf("%s: got %d snippets, want the default of %d", r.Location.URI, len(r.Snippets), searchSnippets)
+		}
+	}
+
+	results = search(SearchParams{Query: "zeta", Limit: 2, Snippets: 1})
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].Score < results[1].Score {
+		t.Errorf("got scores %v and %v, want the best first", results[0].Score, results[1].Score)
+	}
+	for _, r := range results {
+		if len(r.Snippets) != 1 || r.Snippets[0].Text != "zeta" {
+			t.Errorf("%s: got snippets %+v, want one", r.Location.URI, r.Snippets)
+		}
+	}
+
+	if results := search(SearchParams{Query: "missing"}); results == nil || len(results) != 0 {
+		t.Errorf("got %#v, want no results", results)
+	}
+
+	for _, params := range []SearchParams{
+		{Query: "zeta", Limit: -1},
+		{Query: "zeta", Snippets: -1},
+	} {
+		if _, err := s.zetaSearch(nil, &params); err == nil {
+			t.Errorf("%+v: got no error", params)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"log"
+	"sort"
+	"zeta/internal/parser"
+	"zeta/internal/sitteradapter"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// Token types for link targets, depending on the state of the target.
+// Every other capture of the query gets a token type named after it.
+const (
+	TokenTypeNoteLink        = "noteLink"
+	TokenTypePlaceholderLink = "placeholderLink"
+	TokenTypeInvalidLink     = "invalidLink"
+)
+
+// semanticToken is a single-line token in absolute coordinates.
+type semanticToken struct {
+	position  protocol.Position
+	length    uint32
+	tokenType int
+}
+
+func (s *Server) textDocumentSemanticTokensFull(
+	context *glsp.Context,
+	params *protocol.SemanticTokensParams,
+) (*protocol.SemanticTokens, error) {
+	tokens, err := s.semanticTokens(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.SemanticTokens{Data: encodeSemanticTokens(tokens)}, nil
+}
+
+func (s *Server) textDocumentSemanticTokensRange(
+	context *glsp.Context,
+	params *protocol.SemanticTokensRangeParams,
+) (any, error) {
+	tokens, err := s.semanticTokens(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	inside := tokens[:0]
+	for _, t := range tokens {
+		if inRange(t.position, params.Range) {
+			inside = append(inside, t)
+		}
+	}
+	return &protocol.SemanticTokens{Data: encodeSemanticTokens(inside)}, nil
+}
+
+// semanticTokenTypes returns the legend of token types for a query.
+func semanticTokenTypes(query string) []string {
+	types := []string{TokenTypeNoteLink, TokenTypePlaceholderLink, TokenTypeInvalidLink}
+	names, err := parser.CaptureNames([]byte(query))
+	if err != nil {
+		log.Printf("Error reading captures of query: %v", err)
+		return types
+	}
+	for _, name := range names {
+		if name != "target" {
+			types = append(types, name)
+		}
+	}
+	return types
+}
+
+// semanticTokensRegistration identifies semantic tokens in dynamic
+// registrations.
+const semanticTokensRegistration = "zeta-semantic-tokens"
+
+func (s *Server) semanticTokensOptions() protocol.SemanticTokensOptions {
+	return protocol.SemanticTokensOptions{
+		Legend: protocol.SemanticTokensLegend{
+			TokenTypes:     s.tokenTypes,
+			TokenModifiers: []string{},
+		},
+		Full:  true,
+		Range: true,
+	}
+}
+
+// registersSemanticTokens reports whether the client lets zeta register
+// semantic tokens dynamically. Only then can the legend follow a new query.
+func (s *Server) registersSemanticTokens() bool {
+	document := s.capabilities.TextDocument
+	return document != nil && document.SemanticTokens != nil &&
+		document.SemanticTokens.DynamicRegistration != nil &&
+		*document.SemanticTokens.DynamicRegistration
+}
+
+// registerSemanticTokens registers semantic tokens with a legend. It waits
+// for the client, so it must not run in a handler.
+func (s *Server) registerSemanticTokens(options protocol.SemanticTokensOptions) error {
+	params := protocol.RegistrationParams{
+		Registrations: []protocol.Registration{
+			{
+				ID:     semanticTokensRegistration,
+				Method: "textDocument/semanticTokens",
+				RegisterOptions: protocol.SemanticTokensRegistrationOptions{
+					SemanticTokensOptions: options,
+				},
+			},
+		},
+	}
+	return s.call(string(protocol.ServerClientRegisterCapability), params, nil)
+}
+
+// reregisterSemanticTokens replaces the legend in the client after the
+// query changed, and has it request the tokens again.
+func (s *Server) reregisterSemanticTokens(options protocol.SemanticTokensOptions) {
+	params := protocol.UnregistrationParams{
+		Unregisterations: []protocol.Unregistration{
+			{ID: semanticTokensRegistration, Method: "textDocument/semanticTokens"},
+		},
+	}
+	if err := s.call(string(protocol.ServerClientUnregisterCapability), params, nil); err != nil {
+		log.Printf("Error unregistering semantic tokens: %v", err)
+		return
+	}
+	if err := s.registerSemanticTokens(options); err != nil {
+		log.Printf("Error registering semantic tokens: %v", err)
+		return
+	}
+	workspace := s.capabilities.Workspace
+	if workspace != nil && workspace.SemanticTokens != nil &&
+		workspace.SemanticTokens.RefreshSupport != nil && *workspace.SemanticTokens.RefreshSupport {
+		if err := s.call(string(protocol.MethodWorkspaceSemanticTokensRefresh), nil, nil); err != nil {
+			log.Printf("Error refreshing semantic tokens: %v", err)
+		}
+	}
+}
+
+// semanticTokens returns the sorted, non-overlapping tokens of a document.
+func (s *Server) semanticTokens(uri protocol.DocumentUri) ([]semanticToken, error) {
+	v, note, err := s.vaultOf(uri)
+	if err != nil {
+		return nil, err
+	}
+	nodes, doc, err := v.manager.Query(note.URI, s.config.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(s.tokenTypes))
+	for i, t := range s.tokenTypes {
+		index[t] = i
+	}
+
+	var tokens []semanticToken
+	for name, captured := range nodes {
+		for _, n := range captured {
+			var tokenType string
+			if name == "target" {
+				target, err := v.resolver.ResolveReference(note, n.Content(doc))
+				switch {
+				case err != nil:
+					tokenType = TokenTypeInvalidLink
+				case s.noteExists(target):
+					tokenType = TokenTypeNoteLink
+				default:
+					tokenType = TokenTypePlaceholderLink
+				}
+			} else {
+				tokenType = name
+			}
+			i, ok := index[tokenType]
+			if !ok {
+				continue
+			}
+
+			start := sitteradapter.TSPointToLSPPosition(n.StartPoint(), string(doc))
+			end := sitteradapter.TSPointToLSPPosition(n.EndPoint(), string(doc))
+			if end.Line != start.Line {
+				// tokens may not span lines, so only the first line is highlighted
+				end = start.EndOfLineIn(string(doc))
+			}
+			if end.Character <= start.Character {
+				continue
+			}
+			tokens = append(tokens, semanticToken{
+				position:  start,
+				length:    end.Character - start.Character,
+				tokenType: i,
+			})
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		a, b := tokens[i].position, tokens[j].position
+		return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+	})
+	// Drop tokens overlapping their predecessor.
+	kept := tokens[:0]
+	for _, t := range tokens {
+		if n := len(kept); n > 0 {
+			last := kept[n-1]
+			if last.position.Line == t.position.Line &&
+				last.position.Character+last.length > t.position.Character {
+				continue
+			}
+		}
+		kept = append(kept, t)
+	}
+	return kept, nil
+}
+
+// encodeSemanticTokens encodes sorted tokens relative to each other.
+func encodeSemanticTokens(tokens []semanticToken) []protocol.UInteger {
+	data := make([]protocol.UInteger, 0, 5*len(tokens))
+	var line, character uint32
+	for _, t := range tokens {
+		deltaLine := t.position.Line - line
+		deltaCharacter := t.position.Character
+		if deltaLine == 0 {
+			deltaCharacter -= character
+		}
+		data = append(data, deltaLine, deltaCharacter, t.length, protocol.UInteger(t.tokenType), 0)
+		line, character = t.position.Line, t.position.Character
+	}
+	return data
+}
@@ -1,37 +1,84 @@
 package server
 
 import (
-	"zeta/internal/cache"
+	"context"
+	"sync"
+	"sync/atomic"
 	"zeta/internal/config"
-	"zeta/internal/manager"
+	"zeta/internal/parser"
 
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
-	"github.com/tliron/glsp/server"
 )
 
 type Server struct {
-	handler   *protocol.Handler
-	cache     cache.Cache
-	manager   *manager.DocumentManager
-	graphAddr string
-	config    config.Config
+	mu           sync.RWMutex // held for writing while reconfiguring
+	handler      *protocol.Handler
+	dispatch     glsp.Handler                  // handler with the custom methods
+	ctx          context.Context               // cancelled when the client disconnects
+	conn         atomic.Pointer[jsonrpc2.Conn] // to the client
+	vaults       []*vault
+	roots        vaultRoots
+	graphAddr    string
+	config       config.Config
+	initConfig   config.Config // from the initialization options
+	capabilities protocol.ClientCapabilities
+	client       *glsp.Context // for requests to the client outside of handlers
+	tokenTypes   []string      // semantic token legend
+	parsers      *parser.ParserPool
+	polling      bool            // whether vaults are polled for changes
+	listeners    context.Context // cancelled when the caches change
+	stopListen   context.CancelFunc
+	progressID   atomic.Int64 // for unique progress tokens
+	orphanMu     sync.Mutex
+	orphaned     map[string]bool // notes shown with an orphan hint
 }
 
-func NewServer() (*server.Server, error) {
+func NewServer() (*Server, error) {
 	ls := &Server{}
 	ls.handler = &protocol.Handler{
-		Initialize:              ls.initialize,
-		Initialized:             ls.initialized,
-		TextDocumentDidOpen:     ls.textDocumentDidOpen,
-		TextDocumentDidChange:   ls.textDocumentDidChange,
-		TextDocumentDidSave:     ls.textDocumentDidSave,
-		TextDocumentDidClose:    ls.textDocumentDidClose,
-		TextDocumentDefinition:  ls.textDocumentDefinition,
-		TextDocumentReferences:  ls.textDocumentReferences,
-		WorkspaceExecuteCommand: ls.workspaceExecuteCommand,
-		WorkspaceSymbol:         ls.workspaceSymbol,
-		Shutdown:                ls.shutdown,
+		Initialize:                         ls.initialize,
+		Initialized:                        ls.initialized,
+		TextDocumentDidOpen:                ls.textDocumentDidOpen,
+		TextDocumentDidChange:              ls.textDocumentDidChange,
+		TextDocumentDidSave:                ls.textDocumentDidSave,
+		TextDocumentDidClose:               ls.textDocumentDidClose,
+		TextDocumentDefinition:             ls.textDocumentDefinition,
+		TextDocumentReferences:             ls.textDocumentReferences,
+		TextDocumentCompletion:             ls.textDocumentCompletion,
+		TextDocumentHover:                  ls.textDocumentHover,
+		TextDocumentRename:                 ls.textDocumentRename,
+		TextDocumentPrepareRename:          ls.textDocumentPrepareRename,
+		TextDocumentCodeAction:             ls.textDocumentCodeAction,
+		TextDocumentCodeLens:               ls.textDocumentCodeLens,
+		TextDocumentDocumentLink:           ls.textDocumentDocumentLink,
+		TextDocumentDocumentSymbol:         ls.textDocumentDocumentSymbol,
+		TextDocumentPrepareCallHierarchy:   ls.textDocumentPrepareCallHierarchy,
+		CallHierarchyIncomingCalls:         ls.callHierarchyIncomingCalls,
+		CallHierarchyOutgoingCalls:         ls.callHierarchyOutgoingCalls,
+		TextDocumentSemanticTokensFull:     ls.textDocumentSemanticTokensFull,
+		TextDocumentSemanticTokensRange:    ls.textDocumentSemanticTokensRange,
+		WorkspaceExecuteCommand:            ls.workspaceExecuteCommand,
+		WorkspaceSymbol:                    ls.workspaceSymbol,
+		WorkspaceWillRenameFiles:           ls.workspaceWillRenameFiles,
+		WorkspaceDidRenameFiles:            ls.workspaceDidRenameFiles,
+		WorkspaceDidDeleteFiles:            ls.workspaceDidDeleteFiles,
+		WorkspaceDidChangeWatchedFiles:     ls.workspaceDidChangeWatchedFiles,
+		WorkspaceDidChangeConfiguration:    ls.workspaceDidChangeConfiguration,
+		WorkspaceDidChangeWorkspaceFolders: ls.workspaceDidChangeWorkspaceFolders,
+		Shutdown:                           ls.shutdown,
+		Exit:                               ls.exit,
 	}
 
-	return server.NewServer(ls.handler, "zeta", false), nil
+	ls.dispatch = &handler{
+		Handler: ls.handler,
+		custom: map[string]customFunc{
+			MethodTextDocumentInlayHint: customRequest(ls.textDocumentInlayHint),
+			MethodSearch:                customRequest(ls.zetaSearch),
+		},
+		mu: &ls.mu,
+	}
+
+	return ls, nil
 }
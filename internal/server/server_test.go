@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"zeta/internal/cache"
+	"zeta/internal/config"
+	"zeta/internal/manager"
+	"zeta/internal/parser"
+	"zeta/internal/search"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// newTestServer serves a vault named "notes" with the given notes, by path
+// and content. Instead of scanning, which needs the tree-sitter grammar, the
+// cache is filled with the links of every note as parsing would find them.
+func newTestServer(t *testing.T, notes map[string]string, links map[string][]cache.Link) (*Server, *vault) {
+	t.Helper()
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.config, s.initConfig, s.parsers = cfg, cfg, parser.NewParserPool(1)
+	s.handler.SetInitialized(true)
+
+	root := t.TempDir()
+	for path, content := range notes {
+		abs := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(abs, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := newResolver(root, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = r.WithVaults("notes", &s.roots)
+	v := &vault{
+		name:      "notes",
+		root:      root,
+		resolver:  r,
+		cache:     cache.NewCache(),
+		search:    search.NewIndex(),
+		cacheFile: filepath.Join(t.TempDir(), "cache.json"),
+		manager:   manager.NewDocumentManager(r),
+		stopScan:  func() {},
+		progress:  newScanProgress(),
+	}
+	close(v.progress.done)
+	s.roots.set(v.name, root)
+	s.vaults = append(s.vaults, v)
+
+	for path, content := range notes {
+		state := cache.NewFileState([]byte(content), time.Now())
+		if err := v.cache.SaveNote(path, links[path], nil, state); err != nil {
+			t.Fatal(err)
+		}
+		v.search.Put(path, search.Analyze([]byte(content)))
+	}
+	return s, v
+}
+
+// link is a link from source to target at the given range of the source,
+// on its first line.
+func link(source, target string, start, end uint32) cache.Link {
+	return cache.Link{
+		Source: source,
+		Target: target,
+		Ranges: []protocol.Range{{
+			Start: protocol.Position{Line: 0, Character: start},
+			End:   protocol.Position{Line: 0, Character: end},
+		}},
+	}
+}
+
+// workspaceEditCapabilities are the capabilities of a client that applies
+// documentChanges with the given resource operations.
+func workspaceEditCapabilities(operations ...protocol.ResourceOperationKind) protocol.ClientCapabilities {
+	var c protocol.ClientCapabilities
+	// Workspace is of an unnamed type.
+	if err := json.Unmarshal([]byte(`{"workspace": {}}`), &c); err != nil {
+		panic(err)
+	}
+	c.Workspace.WorkspaceEdit = &protocol.WorkspaceEditClientCapabilities{
+		DocumentChanges:    &protocol.True,
+		ResourceOperations: operations,
+	}
+	return c
+}
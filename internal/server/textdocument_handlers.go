@@ -2,9 +2,11 @@ package server
 
 import (
 	"fmt"
+	"os"
 	"time"
 	"zeta/internal/cache"
 	"zeta/internal/resolver"
+	"zeta/internal/search"
 
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
@@ -14,19 +16,23 @@ func (s *Server) textDocumentDidOpen(
 	context *glsp.Context,
 	params *protocol.DidOpenTextDocumentParams,
 ) error {
-	note, _ := resolver.Resolve(params.TextDocument.URI)
-	if _, err := s.manager.EnsureParser(note.URI); err != nil {
+	v, note, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	if _, err := v.manager.EnsureParser(note.URI); err != nil {
 		return err
 	}
-	s.manager.UpdateDocument(note.URI, []byte(params.TextDocument.Text))
-	links, meta, err := s.manager.GetLinksAndMeta(note.URI, s.config.Query)
+	v.manager.UpdateDocument(note.URI, []byte(params.TextDocument.Text))
+	links, meta, err := v.manager.GetLinksAndMeta(note.URI, s.config.Query)
 	if err != nil {
 		return err
 	}
-	if err := s.cache.EditNote(note.RelativePath, links, meta); err != nil {
+	if err := v.cache.EditNote(note.RelativePath, links, meta); err != nil {
 		return err
 	}
-	publishDiagnostics(context, note.URI, s.linkDiagnostics(links))
+	v.search.Put(note.RelativePath, search.Analyze([]byte(params.TextDocument.Text)))
+	publishDiagnostics(context, note.URI, s.noteDiagnostics(v, note.URI, links))
 	return nil
 }
 
@@ -34,25 +40,31 @@ func (s *Server) textDocumentDidChange(
 	context *glsp.Context,
 	params *protocol.DidChangeTextDocumentParams,
 ) error {
-	note, _ := resolver.Resolve(params.TextDocument.TextDocumentIdentifier.URI)
-	s.manager.EnsureParser(note.URI)
+	v, note, err := s.vaultOf(params.TextDocument.TextDocumentIdentifier.URI)
+	if err != nil {
+		return err
+	}
+	v.manager.EnsureParser(note.URI)
 	for _, raw := range params.ContentChanges {
 		change, ok := raw.(protocol.TextDocumentContentChangeEvent)
 		if !ok {
 			return fmt.Errorf("unexpected change event type %T", raw)
 		}
-		if err := s.manager.ApplyIncrementalEdit(note.URI, change); err != nil {
+		if err := v.manager.ApplyIncrementalEdit(note.URI, change); err != nil {
 			return fmt.Errorf("unexpected error during edit: %v", err)
 		}
 	}
-	links, meta, err := s.manager.GetLinksAndMeta(note.URI, s.config.Query)
+	links, meta, err := v.manager.GetLinksAndMeta(note.URI, s.config.Query)
 	if err != nil {
 		return err
 	}
-	if err := s.cache.EditNote(note.RelativePath, links, meta); err != nil {
+	if err := v.cache.EditNote(note.RelativePath, links, meta); err != nil {
 		return err
 	}
-	publishDiagnostics(context, note.URI, s.linkDiagnostics(links))
+	if document, err := v.manager.GetDocument(note.URI); err == nil {
+		v.search.Put(note.RelativePath, search.Analyze(document))
+	}
+	publishDiagnostics(context, note.URI, s.noteDiagnostics(v, note.URI, links))
 	return nil
 }
 
@@ -60,19 +72,28 @@ func (s *Server) textDocumentDidSave(
 	context *glsp.Context,
 	params *protocol.DidSaveTextDocumentParams,
 ) error {
-	note, _ := resolver.Resolve(params.TextDocument.URI)
-	if _, err := s.manager.EnsureParser(note.URI); err != nil {
+	v, note, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	if _, err := v.manager.EnsureParser(note.URI); err != nil {
 		return err
 	}
-	s.manager.UpdateDocument(note.URI, []byte(*params.Text))
-	links, meta, err := s.manager.GetLinksAndMeta(note.URI, s.config.Query)
+	v.manager.UpdateDocument(note.URI, []byte(*params.Text))
+	links, meta, err := v.manager.GetLinksAndMeta(note.URI, s.config.Query)
 	if err != nil {
 		return err
 	}
-	if err := s.cache.SaveNote(note.RelativePath, links, meta, time.Now()); err != nil {
+	modTime := time.Now()
+	if info, err := os.Stat(note.AbsolutePath); err == nil {
+		modTime = info.ModTime()
+	}
+	state := cache.NewFileState([]byte(*params.Text), modTime)
+	if err := v.cache.SaveNote(note.RelativePath, links, meta, state); err != nil {
 		return err
 	}
-	publishDiagnostics(context, note.URI, s.linkDiagnostics(links))
+	v.search.Put(note.RelativePath, search.Analyze([]byte(*params.Text)))
+	publishDiagnostics(context, note.URI, s.noteDiagnostics(v, note.URI, links))
 	return nil
 }
 
@@ -80,14 +101,34 @@ func (s *Server) textDocumentDidClose(
 	context *glsp.Context,
 	params *protocol.DidCloseTextDocumentParams,
 ) error {
-	note, _ := resolver.Resolve(params.TextDocument.URI)
-	if err := s.cache.DiscardNote(note.RelativePath); err != nil {
+	v, note, err := s.vaultOf(params.TextDocument.URI)
+	if err != nil {
 		return err
 	}
-	s.manager.Release(note.URI)
+	if err := v.cache.DiscardNote(note.RelativePath); err != nil {
+		return err
+	}
+	// Unsaved changes are discarded from the search index as well.
+	if document, err := os.ReadFile(note.AbsolutePath); err == nil {
+		v.search.Put(note.RelativePath, search.Analyze(document))
+	} else {
+		v.search.Delete(note.RelativePath)
+	}
+	v.manager.Release(note.URI)
 	return nil
 }
 
+// readDocument returns the content of a note, preferring the open document
+// over the file on disk.
+func (s *Server) readDocument(note resolver.Note) ([]byte, error) {
+	if o := s.owner(note); o != nil {
+		if doc, err := o.manager.GetDocument(note.URI); err == nil {
+			return doc, nil
+		}
+	}
+	return os.ReadFile(note.AbsolutePath)
+}
+
 func publishDiagnostics(
 	context *glsp.Context,
 	uri string,
@@ -99,25 +140,45 @@ func publishDiagnostics(
 	})
 }
 
-func (s *Server) linkDiagnostics(links []cache.Link) []protocol.Diagnostic {
+// noteDiagnostics returns the diagnostics of an open note.
+func (s *Server) noteDiagnostics(v *vault, uri string, links []cache.Link) []protocol.Diagnostic {
+	return append(s.linkDiagnostics(v, links), s.orphanHint(uri)...)
+}
+
+func (s *Server) linkDiagnostics(v *vault, links []cache.Link) []protocol.Diagnostic {
 	diagnostics := []protocol.Diagnostic{} // empty, not nil
 	// Create one diagnostic per range entry for each link
 	info := protocol.DiagnosticSeverityInformation
 	warn := protocol.DiagnosticSeverityWarning
 	for _, l := range links {
+		target, err := v.resolver.Resolve(l.Target)
+		if err != nil {
+			continue
+		}
 		var severity protocol.DiagnosticSeverity
-		if s.cache.NoteExists(l.Target) {
+		var data any
+		if s.noteExists(target) {
+			// titles are shown as inlay hints instead
+			if s.config.LinkHints != LinkHintsDiagnostic {
+				continue
+			}
 			severity = info
 		} else {
 			severity = warn
+			// picked up by the "create note" code action
+			data = l.Target
 		}
 		for _, r := range l.Ranges {
 			t := string(l.Target)
-			m, _ := s.cache.GetMetaData(t)
+			message := "> " + s.title(target)
+			if s.config.LinkHints != LinkHintsDiagnostic {
+				message = "Note " + t + " does not exist yet"
+			}
 			d := protocol.Diagnostic{
 				Range:    r,
 				Severity: &severity,
-				Message:  "> " + resolver.Title(t, m),
+				Message:  message,
+				Data:     data,
 			}
 			diagnostics = append(diagnostics, d)
 		}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"zeta/internal/cache"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestLinkDiagnostics(t *testing.T) {
+	links := []cache.Link{
+		link("a.typ", "b.typ", 6, 9),
+		link("a.typ", "missing.typ", 20, 29),
+	}
+	s, v := newTestServer(t,
+		map[string]string{
+			"a.typ": `#link("b") and #link("missing")`,
+			"b.typ": `= B`,
+		},
+		map[string][]cache.Link{"a.typ": links},
+	)
+	warn := protocol.DiagnosticSeverityWarning
+	missing := protocol.Diagnostic{
+		Range:    links[1].Ranges[0],
+		Severity: &warn,
+		Message:  "Note missing.typ does not exist yet",
+		Data:     "missing.typ",
+	}
+
+	// Titles of existing notes are inlay hints, so only the missing note
+	// remains, with its path for the code action.
+	got := s.linkDiagnostics(v, links)
+	if want := []protocol.Diagnostic{missing}; !reflect.DeepEqual(got, want) {
+		t.Errorf("inlay hints: got %+v, want %+v", got, want)
+	}
+
+	s.config.LinkHints = LinkHintsDiagnostic
+	b, err := v.resolver.Resolve("b.typ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = s.linkDiagnostics(v, links)
+	if len(got) != 2 {
+		t.Fatalf("diagnostic hints: got %d diagnostics, want 2: %+v", len(got), got)
+	}
+	info := protocol.DiagnosticSeverityInformation
+	title := protocol.Diagnostic{
+		Range:    links[0].Ranges[0],
+		Severity: &info,
+		Message:  "> " + s.title(b),
+	}
+	if !reflect.DeepEqual(got[0], title) {
+		t.Errorf("diagnostic hints: got %+v, want %+v", got[0], title)
+	}
+	if got[1].Data != "missing.typ" || *got[1].Severity != warn {
+		t.Errorf("diagnostic hints: got %+v for the missing note", got[1])
+	}
+}
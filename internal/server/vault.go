@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"zeta/internal/cache"
+	"zeta/internal/manager"
+	"zeta/internal/resolver"
+	"zeta/internal/search"
+)
+
+// vault is a workspace folder. Every vault has its own resolver, cache,
+// documents and scan.
+type vault struct {
+	name      string
+	root      string
+	resolver  *resolver.Resolver
+	cache     cache.Cache
+	search    *search.Index // of the note contents, rebuilt by every scan
+	cacheFile string
+	flushed   atomic.Uint64 // generation of the cache last written
+	manager   *manager.DocumentManager
+	stopScan  context.CancelFunc
+	progress  *scanProgress      // of the latest scan
+	stopPoll  context.CancelFunc // nil unless polling for changes
+}
+
+// vaultLink is a link together with the vault whose cache holds it.
+type vaultLink struct {
+	cache.Link
+	vault *vault
+}
+
+// vaultRoots maps the names of vaults to their roots. It is shared by the
+// resolvers of all vaults to resolve cross-vault references.
+type vaultRoots struct {
+	mu    sync.RWMutex
+	roots map[string]string
+}
+
+func (vr *vaultRoots) Root(name string) (string, bool) {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+	root, ok := vr.roots[name]
+	return root, ok
+}
+
+// Vault returns the vault with the innermost root containing the path.
+func (vr *vaultRoots) Vault(absolutepath string) (string, string, bool) {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+	var name, root string
+	for n, r := range vr.roots {
+		rel, err := filepath.Rel(r, absolutepath)
+		if err != nil || !filepath.IsLocal(rel) && rel != "." {
+			continue
+		}
+		if len(r) > len(root) {
+			name, root = n, r
+		}
+	}
+	return name, root, root != ""
+}
+
+func (vr *vaultRoots) set(name string, root string) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	if vr.roots == nil {
+		vr.roots = map[string]string{}
+	}
+	vr.roots[name] = root
+}
+
+func (vr *vaultRoots) remove(name string) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	delete(vr.roots, name)
+}
+
+// vaultName returns a name for the vault at root that no other vault uses.
+func (s *Server) vaultName(name string, root string) string {
+	if name == "" {
+		name = filepath.Base(root)
+	}
+	unique := name
+	for i := 2; s.vault(unique) != nil; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	return unique
+}
+
+// vault returns the vault with the given name, or nil.
+func (s *Server) vault(name string) *vault {
+	for _, v := range s.vaults {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// vaultOf returns the vault containing a document together with its note.
+func (s *Server) vaultOf(uri string) (*vault, resolver.Note, error) {
+	name, _, ok := s.roots.Vault(uriPath(uri))
+	v := s.vault(name)
+	if !ok || v == nil {
+		return nil, resolver.Note{}, fmt.Errorf("%s is not in a workspace folder", uri)
+	}
+	note, err := v.resolver.Resolve(uri)
+	return v, note, err
+}
+
+// owner returns the vault a note belongs to, or nil.
+func (s *Server) owner(note resolver.Note) *vault {
+	return s.vault(note.Vault)
+}
+
+// noteExists reports whether a note exists in the cache of its vault.
+func (s *Server) noteExists(note resolver.Note) bool {
+	o := s.owner(note)
+	return o != nil && o.cache.NoteExists(note.RelativePath)
+}
+
+// metadata returns the metadata of a note from the cache of its vault.
+func (s *Server) metadata(note resolver.Note) cache.Metadata {
+	o := s.owner(note)
+	if o == nil {
+		return nil
+	}
+	meta, _ := o.cache.GetMetaData(note.RelativePath)
+	return meta
+}
+
+// title returns the title of a note from the cache of its vault.
+func (s *Server) title(note resolver.Note) string {
+	o := s.owner(note)
+	if o == nil {
+		return string(note.CachePath)
+	}
+	return o.resolver.Title(note.CachePath, s.metadata(note))
+}
+
+// incomingLinks returns the links to a note from all vaults.
+func (s *Server) incomingLinks(note resolver.Note) ([]vaultLink, error) {
+	o := s.owner(note)
+	if o == nil {
+		return nil, fmt.Errorf("%s is not in a workspace folder", note.URI)
+	}
+	var links []vaultLink
+	for _, v := range s.vaults {
+		path := note.RelativePath
+		if v != o {
+			path = resolver.Qualify(o.name, path)
+		}
+		backlinks, err := v.cache.GetBackLinks(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range backlinks {
+			links = append(links, vaultLink{Link: l, vault: v})
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+	"zeta/internal/cache"
+	"zeta/internal/resolver"
+	"zeta/internal/search"
+	"zeta/internal/watcher"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func (s *Server) workspaceDidChangeWatchedFiles(
+	context *glsp.Context,
+	params *protocol.DidChangeWatchedFilesParams,
+) error {
+	for _, change := range params.Changes {
+		switch change.Type {
+		case protocol.FileChangeTypeCreated, protocol.FileChangeTypeChanged:
+			s.fileChanged(uriPath(change.URI))
+		case protocol.FileChangeTypeDeleted:
+			s.fileDeleted(uriPath(change.URI))
+		}
+	}
+	return nil
+}
+
+// watchFiles makes sure zeta learns about notes changed outside the editor,
+// preferably through the client and otherwise by polling every vault.
+func (s *Server) watchFiles(ctx *glsp.Context) {
+	workspace := s.capabilities.Workspace
+	if workspace != nil && workspace.DidChangeWatchedFiles != nil &&
+		workspace.DidChangeWatchedFiles.DynamicRegistration != nil &&
+		*workspace.DidChangeWatchedFiles.DynamicRegistration {
+		var watchers []protocol.FileSystemWatcher
+		for _, ext := range s.config.FileExtensions {
+			watchers = append(watchers, protocol.FileSystemWatcher{GlobPattern: "**/*" + ext})
+		}
+		params := protocol.RegistrationParams{
+			Registrations: []protocol.Registration{
+				{
+					ID:     "zeta-watched-files",
+					Method: string(protocol.MethodWorkspaceDidChangeWatchedFiles),
+					RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{
+						Watchers: watchers,
+					},
+				},
+			},
+		}
+		// Requests to the client must not block the handler.
+		go ctx.Call(string(protocol.ServerClientRegisterCapability), params, nil)
+		return
+	}
+
+	if s.config.WatchInterval <= 0 {
+		return
+	}
+	log.Printf("Client cannot watch files, polling every %ds", s.config.WatchInterval)
+	s.polling = true
+	for _, v := range s.vaults {
+		s.poll(v)
+	}
+}
+
+// poll watches a vault by polling. Reconfiguring restarts it.
+func (s *Server) poll(v *vault) {
+	ctx, cancel := context.WithCancel(context.Background())
+	v.stopPoll = cancel
+	go watcher.Watch(
+		ctx,
+		v.resolver,
+		time.Duration(s.config.WatchInterval)*time.Second,
+		s.readLocked(s.fileChanged),
+		s.readLocked(s.fileDeleted),
+	)
+}
+
+// readLocked wraps a callback from outside a handler so that it does not
+// race with reconfiguring.
+func (s *Server) readLocked(f func(absolutepath string)) func(absolutepath string) {
+	return func(absolutepath string) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		f(absolutepath)
+	}
+}
+
+// fileChanged re-indexes a note that changed on disk, unless it is open.
+func (s *Server) fileChanged(absolutepath string) {
+	v, note, err := s.vaultOf(absolutepath)
+	if err != nil || v.manager.IsOpen(note.URI) {
+		return
+	}
+	document, err := os.ReadFile(note.AbsolutePath)
+	if err != nil {
+		log.Printf("Error reading %s: %v", absolutepath, err)
+		return
+	}
+	modTime := time.Now()
+	if info, err := os.Stat(note.AbsolutePath); err == nil {
+		modTime = info.ModTime()
+	}
+	if err := s.indexDocument(v, note, document, cache.NewFileState(document, modTime)); err != nil {
+		log.Printf("Error indexing %s: %v", absolutepath, err)
+	}
+}
+
+// fileDeleted removes a note deleted on disk, unless it is open.
+func (s *Server) fileDeleted(absolutepath string) {
+	v, note, err := s.vaultOf(absolutepath)
+	if err != nil || v.manager.IsOpen(note.URI) {
+		return
+	}
+	v.search.Delete(note.CachePath)
+	err = v.cache.DeleteNote(note.CachePath)
+	if err != nil && err != cache.ErrNoteNotFound {
+		log.Printf("Error deleting %s: %v", absolutepath, err)
+	}
+}
+
+// parsedNote holds the links and metadata of a note, ready for the cache,
+// and its content, ready for the search index.
+type parsedNote struct {
+	links     []cache.Link
+	meta      cache.Metadata
+	state     cache.FileState
+	unchanged bool // the cache has the same content, so nothing was parsed
+	indexOnly bool // the file is unchanged, so only content is set
+	content   search.Document
+}
+
+// parseDocument extracts the links and metadata of a note.
+func (s *Server) parseDocument(v *vault, note resolver.Note, document []byte) (parsedNote, error) {
+	nodes, err := s.parsers.ParseAndQuery(document, []byte(s.config.Query))
+	if err != nil {
+		return parsedNote{}, err
+	}
+	links, meta := v.resolver.ExtractLinksAndMeta(note, nodes, document)
+	return parsedNote{links: links, meta: meta}, nil
+}
+
+// parseChanged parses a note unless the cache of its vault has the same
+// content already. The content is analysed for the search index either way,
+// as the index is not saved with the cache.
+func (s *Server) parseChanged(v *vault, note resolver.Note, document []byte, state cache.FileState) (parsedNote, error) {
+	content := search.Analyze(document)
+	if old, ok := v.cache.GetFileState(note.CachePath); ok && old.SameContent(state) {
+		return parsedNote{state: state, unchanged: true, content: content}, nil
+	}
+	parsed, err := s.parseDocument(v, note, document)
+	parsed.state = state
+	parsed.content = content
+	return parsed, err
+}
+
+// commitParsed commits a note parsed by parseChanged to the cache and search
+// index of its vault.
+func commitParsed(v *vault, note resolver.Note, parsed parsedNote) error {
+	v.search.Put(note.CachePath, parsed.content)
+	if parsed.indexOnly {
+		return nil
+	}
+	if parsed.unchanged {
+		return v.cache.SetFileState(note.CachePath, parsed.state)
+	}
+	return v.cache.SaveNote(note.CachePath, parsed.links, parsed.meta, parsed.state)
+}
+
+// indexDocument parses a note, if its content changed, and commits its links
+// and metadata to the cache of its vault.
+func (s *Server) indexDocument(v *vault, note resolver.Note, document []byte, state cache.FileState) error {
+	parsed, err := s.parseChanged(v, note, document, state)
+	if err != nil {
+		return err
+	}
+	return commitParsed(v, note, parsed)
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"zeta/internal/cache"
+	"zeta/internal/resolver"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func (s *Server) workspaceWillRenameFiles(
+	context *glsp.Context,
+	params *protocol.RenameFilesParams,
+) (*protocol.WorkspaceEdit, error) {
+	// Edits from a partial index would miss links.
+	if !s.indexed() {
+		return nil, fmt.Errorf("notes are still being indexed, try again shortly")
+	}
+	edits, err := s.renameEdits(s.fileMoves(params.Files))
+	if err != nil {
+		return nil, err
+	}
+	if len(edits) == 0 {
+		return nil, nil
+	}
+	return s.workspaceEdit(edits), nil
+}
+
+func (s *Server) workspaceDidRenameFiles(
+	context *glsp.Context,
+	params *protocol.RenameFilesParams,
+) error {
+	// The cache follows only once the client has renamed the files.
+	s.moveNotes(s.fileMoves(params.Files))
+	return nil
+}
+
+func (s *Server) workspaceDidDeleteFiles(
+	context *glsp.Context,
+	params *protocol.DeleteFilesParams,
+) error {
+	for _, f := range params.Files {
+		for _, note := range s.notesUnder(f.URI) {
+			o := s.owner(note)
+			o.search.Delete(note.RelativePath)
+			if err := o.cache.DeleteNote(note.RelativePath); err != nil {
+				log.Printf("Error deleting %s: %v", note.CachePath, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fileMoves maps the absolute path of every note affected by the file renames
+// to its new location. Renamed directories move all notes below them.
+func (s *Server) fileMoves(files []protocol.FileRename) map[string]resolver.Note {
+	moves := map[string]resolver.Note{}
+	for _, f := range files {
+		if _, from, err := s.vaultOf(f.OldURI); err == nil {
+			if _, to, err := s.vaultOf(f.NewURI); err == nil {
+				moves[from.AbsolutePath] = to
+			}
+			continue
+		}
+		// Not a note itself, so treat it as a directory.
+		from, to := uriPath(f.OldURI), uriPath(f.NewURI)
+		for _, note := range s.notesUnder(f.OldURI) {
+			rel, err := filepath.Rel(from, note.AbsolutePath)
+			if err != nil {
+				continue
+			}
+			if _, newNote, err := s.vaultOf(filepath.Join(to, rel)); err == nil {
+				moves[note.AbsolutePath] = newNote
+			}
+		}
+	}
+	return moves
+}
+
+// moveNotes applies moves computed by fileMoves to the caches. Notes moved
+// to another vault are removed from their old vault and picked up by the
+// new one once their file is created.
+func (s *Server) moveNotes(moves map[string]resolver.Note) {
+	for path, to := range moves {
+		v, from, err := s.vaultOf(path)
+		if err != nil {
+			continue
+		}
+		if from.Vault != to.Vault {
+			v.search.Delete(from.RelativePath)
+			err = v.cache.DeleteNote(from.RelativePath)
+		} else {
+			v.search.Rename(from.RelativePath, to.RelativePath)
+			err = v.cache.RenameNote(from.RelativePath, to.RelativePath)
+		}
+		if err != nil && err != cache.ErrNoteNotFound {
+			log.Printf("Error moving %s to %s: %v", path, to.AbsolutePath, err)
+		}
+	}
+}
+
+// notesUnder returns the cached notes at or below the given file or
+// directory, from all vaults.
+func (s *Server) notesUnder(uri string) []resolver.Note {
+	if _, note, err := s.vaultOf(uri); err == nil {
+		return []resolver.Note{note}
+	}
+	dir := uriPath(uri) + string(filepath.Separator)
+	var notes []resolver.Note
+	for _, v := range s.vaults {
+		for _, path := range v.cache.GetPaths() {
+			note, err := v.resolver.Resolve(path)
+			if err != nil || note.Vault != v.name {
+				continue
+			}
+			if strings.HasPrefix(note.AbsolutePath, dir) {
+				notes = append(notes, note)
+			}
+		}
+	}
+	return notes
+}
+
+// uriPath returns the file system path of a file URI.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	return filepath.Clean(u.Path)
+}
+
+// fileOperationFilters returns filters for all notes and directories.
+func (s *Server) fileOperationFilters() *protocol.FileOperationRegistrationOptions {
+	scheme := "file"
+	files := protocol.FileOperationPatternKindFile
+	folders := protocol.FileOperationPatternKindFolder
+	return &protocol.FileOperationRegistrationOptions{
+		Filters: []protocol.FileOperationFilter{
+			{
+				Scheme: &scheme,
+				Pattern: protocol.FileOperationPattern{
+					Glob:    "**/*{" + strings.Join(s.config.FileExtensions, ",") + "}",
+					Matches: &files,
+				},
+			},
+			{
+				Scheme:  &scheme,
+				Pattern: protocol.FileOperationPattern{Glob: "**", Matches: &folders},
+			},
+		},
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"log"
+	"zeta/internal/manager"
+	"zeta/internal/search"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func (s *Server) workspaceDidChangeWorkspaceFolders(
+	context *glsp.Context,
+	params *protocol.DidChangeWorkspaceFoldersParams,
+) error {
+	// Changing the vaults needs the write lock, which running handlers hold
+	// for reading.
+	go func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for _, folder := range params.Event.Removed {
+			s.removeVault(uriPath(folder.URI))
+		}
+		for _, folder := range params.Event.Added {
+			if err := s.addVault(folder); err != nil {
+				log.Printf("Error adding workspace folder %s: %v", folder.URI, err)
+			}
+		}
+		if err := s.listen(); err != nil {
+			log.Printf("Error subscribing to cache: %v", err)
+		}
+	}()
+	return nil
+}
+
+// addVault sets up the vault of a workspace folder and starts scanning it.
+func (s *Server) addVault(folder protocol.WorkspaceFolder) error {
+	root := uriPath(folder.URI)
+	name := s.vaultName(folder.Name, root)
+	r, err := newResolver(root, s.config)
+	if err != nil {
+		return err
+	}
+	r = r.WithVaults(name, &s.roots)
+	cacheFile, err := cachePath(root, s.config)
+	if err != nil {
+		return err
+	}
+
+	v := &vault{
+		name:      name,
+		root:      root,
+		resolver:  r,
+		cache:     openCache(cacheFile),
+		search:    search.NewIndex(),
+		cacheFile: cacheFile,
+		manager:   manager.NewDocumentManager(r),
+	}
+	log.Printf("Adding vault %s at %s", name, root)
+	s.roots.set(name, root)
+	s.vaults = append(s.vaults, v)
+	s.scan(v)
+	if s.polling {
+		s.poll(v)
+	}
+	return nil
+}
+
+// removeVault stops watching the vault at root and saves its cache.
+func (s *Server) removeVault(root string) {
+	for i, v := range s.vaults {
+		if v.root != root {
+			continue
+		}
+		log.Printf("Removing vault %s at %s", v.name, root)
+		v.stopScan()
+		if v.stopPoll != nil {
+			v.stopPoll()
+		}
+		v.flush()
+		v.manager.CloseAll()
+		s.roots.remove(v.name)
+		s.vaults = append(s.vaults[:i], s.vaults[i+1:]...)
+		return
+	}
+}
@@ -120,3 +120,14 @@ func TSPointToLSPPosition(pt sitter.Point, document string) lsp.Position {
 	}
 	return lsp.Position{Line: pt.Row, Character: charCount}
 }
+
+// OffsetToLSPPosition converts a byte offset to an LSP Position within the given document.
+func OffsetToLSPPosition(offset int, document string) lsp.Position {
+	if offset > len(document) {
+		offset = len(document)
+	}
+	prefix := document[:offset]
+	row := strings.Count(prefix, "\n")
+	column := offset - (strings.LastIndex(prefix, "\n") + 1)
+	return TSPointToLSPPosition(sitter.Point{Row: uint32(row), Column: uint32(column)}, document)
+}
@@ -0,0 +1,86 @@
+// watcher is used to poll a directory for changed notes.
+package watcher
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"time"
+	"zeta/internal/resolver"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// same reports whether two states describe an unchanged file. Times are
+// compared with Equal, since == also compares their location and monotonic
+// reading.
+func (s fileState) same(o fileState) bool {
+	return s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+// Watch polls the subtree under the root of r every interval until ctx is
+// canceled. Files that resolve to notes are tracked. Whenever such a file is
+// created or modified, changed is called with its path, and when it
+// disappears, deleted is called. Files present at the first poll are taken
+// as the baseline and not reported.
+func Watch(
+	ctx context.Context,
+	r *resolver.Resolver,
+	interval time.Duration,
+	changed func(path string),
+	deleted func(path string),
+) {
+	known := snapshot(r)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := snapshot(r)
+		for path, state := range current {
+			if old, ok := known[path]; !ok || !old.same(state) {
+				changed(path)
+			}
+		}
+		for path := range known {
+			if _, ok := current[path]; !ok {
+				deleted(path)
+			}
+		}
+		known = current
+	}
+}
+
+// snapshot records the state of all notes under the root of r.
+func snapshot(r *resolver.Resolver) map[string]fileState {
+	files := map[string]fileState{}
+	filepath.WalkDir(r.Root(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if r.IngoreDir(path) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if _, err := r.Resolve(path); err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return files
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"strings"
 	"zeta/internal/server"
 )
 
@@ -16,6 +17,8 @@ func main() {
 	versionFlag := flag.Bool("version", false, "Print the version of the program")
 	logfileFlag := flag.String("logfile", "", "Path to log file")
 	dumpConfig := flag.String("dump", "", "Dump note metadata as json (path to config file)")
+	orphansConfig := flag.String("orphans", "", "List notes without backlinks or links (path to config file)")
+	searchConfig := flag.String("search", "", "Search the notes for the words given as arguments (path to config file)")
 	flag.Parse()
 
 	// Version
@@ -32,6 +35,22 @@ func main() {
 		return
 	}
 
+	// Orphans command
+	if *orphansConfig != "" {
+		if err := runOrphans(*orphansConfig); err != nil {
+			log.Fatalf("orphans failed: %v", err)
+		}
+		return
+	}
+
+	// Search command
+	if *searchConfig != "" {
+		if err := runSearch(*searchConfig, strings.Join(flag.Args(), " ")); err != nil {
+			log.Fatalf("search failed: %v", err)
+		}
+		return
+	}
+
 	// LSP server
 	// 4 cores
 	runtime.GOMAXPROCS(4)
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// runOrphans prints the notes without backlinks, without links or with
+// links to missing notes only, one per line with the reasons.
+func runOrphans(configPath string) error {
+	_, c, _, err := scanNotes(configPath)
+	if err != nil {
+		return err
+	}
+	for _, o := range c.Topology().OrphanReport() {
+		fmt.Printf("%s\t%s\n", o.Path, strings.Join(o.Reasons(), ","))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"zeta/internal/search"
+)
+
+// searchLimit is the number of notes runSearch prints.
+const searchLimit = 20
+
+// runSearch prints the notes that best match a query, each with the line
+// ranges that match.
+func runSearch(configPath string, query string) error {
+	if strings.TrimSpace(query) == "" {
+		return fmt.Errorf("no search terms given")
+	}
+	r, _, index, err := scanNotes(configPath)
+	if err != nil {
+		return err
+	}
+	for _, hit := range index.Search(query, searchLimit) {
+		note, err := r.Resolve(hit.Path)
+		if err != nil {
+			continue
+		}
+		fmt.Printf("%s (%.2f)\n", hit.Path, hit.Score)
+		document, err := os.ReadFile(note.AbsolutePath)
+		if err != nil {
+			continue
+		}
+		for _, snippet := range search.Snippets(document, query, 3) {
+			// Lines are counted from one, as editors show them.
+			lines := fmt.Sprintf("%d-%d", snippet.StartLine+1, snippet.EndLine+1)
+			if snippet.StartLine == snippet.EndLine {
+				lines = fmt.Sprint(snippet.StartLine + 1)
+			}
+			indent := "\n" + strings.Repeat(" ", len(lines)+4)
+			fmt.Printf("  %s: %s\n", lines, strings.ReplaceAll(snippet.Text, "\n", indent))
+		}
+	}
+	return nil
+}